@@ -0,0 +1,136 @@
+package qthc
+
+// Monoid describes an aggregate of type A over the entries of a tree, for
+// example the sum, minimum or maximum of a value function. Combine must be
+// associative and Identity must be its neutral element, the order in which
+// entries are combined is not defined.
+type Monoid[V, A any] struct {
+	Identity A
+	// Map returns the aggregate of a single entry.
+	Map     func(e *Entry[V]) A
+	Combine func(a, b A) A
+}
+
+// Aggregator answers aggregate queries for one monoid, see AddAggregator().
+type Aggregator[V, A any] struct {
+	qt *QuadTree[V]
+	id int
+	m  Monoid[V, A]
+}
+
+// aggregator computes the cached aggregate of a node from its entries and
+// the cached aggregates of its sub nodes.
+type aggregator[V any] interface {
+	aggregate(n *Node[V]) interface{}
+}
+
+// AddAggregator registers the monoid m with qt. The tree then caches the
+// aggregate of every node, so Aggregate() only combines entries on the
+// border of the query window. Changes of the tree mark the changed nodes,
+// their aggregates are computed again before the change returns, so
+// Aggregate() only reads the tree and may run concurrently with other
+// queries. Entries must not change in a way that changes their aggregate,
+// except through the tree. AddAggregator itself modifies the tree.
+func AddAggregator[V, A any](qt *QuadTree[V], m Monoid[V, A]) *Aggregator[V, A] {
+	ag := new(Aggregator[V, A])
+	ag.qt = qt
+	ag.id = len(qt.aggs)
+	ag.m = m
+	//snapshots may share the slice
+	qt.aggs = append(qt.aggs[:len(qt.aggs):len(qt.aggs)], ag)
+	if qt.root != nil {
+		qt.mutableRoot()
+		qt.root.updateAggregates(qt.aggs, true)
+	}
+	return ag
+}
+
+// Aggregate returns the combined aggregate of all entries inside the window
+// min/max, the same entries that SearchIntersect() returns. Sub trees that
+// are completely inside the window contribute their cached aggregate.
+// Aggregate returns the identity for an empty or invalid window.
+func (ag *Aggregator[V, A]) Aggregate(min, max []float64) A {
+	qt := ag.qt
+	if qt.root == nil || qt.checkWindow(min, max) != nil {
+		return ag.m.Identity
+	}
+	if qt.root.isInside(min, max) {
+		return ag.cached(qt.root)
+	}
+	a := ag.m.Identity
+	stack := qt.getStack()
+	defer qt.putStack(stack)
+	stack.prepareAndPush(qt.root, min, max)
+	for !stack.isEmpty() {
+		sub, ok := stack.peek().nextSlot()
+		if !ok {
+			stack.pop()
+			continue
+		}
+		if v := sub.node; v != nil {
+			if v.isInside(min, max) {
+				a = ag.m.Combine(a, ag.cached(v))
+			} else {
+				stack.prepareAndPush(v, min, max)
+			}
+		} else if v := sub.entry; v != nil {
+			if v.enclosed(min, max) {
+				a = ag.m.Combine(a, ag.m.Map(v))
+			}
+		}
+	}
+	return a
+}
+
+func (ag *Aggregator[V, A]) cached(n *Node[V]) A {
+	return n.aggs[ag.id].(A)
+}
+
+func (ag *Aggregator[V, A]) aggregate(n *Node[V]) interface{} {
+	a := ag.m.Identity
+	if n.isLeaf {
+		for _, e := range n.values[:n.nValues] {
+			a = ag.m.Combine(a, ag.m.Map(e))
+		}
+		return a
+	}
+	for i := 0; i < n.numSlots(); i++ {
+		c := n.slot(i)
+		if v := c.node; v != nil {
+			a = ag.m.Combine(a, ag.cached(v))
+		} else if v := c.entry; v != nil {
+			a = ag.m.Combine(a, ag.m.Map(v))
+		}
+	}
+	return a
+}
+
+// updateAggregates computes the aggregates of all changed nodes. Every
+// change of the tree calls it before it returns.
+func (qt *QuadTree[V]) updateAggregates() {
+	if len(qt.aggs) == 0 || qt.root == nil || !qt.root.dirty {
+		return
+	}
+	qt.mutableRoot()
+	qt.root.updateAggregates(qt.aggs, false)
+}
+
+// updateAggregates computes the aggregates of n and of its changed sub
+// nodes, or of all sub nodes if all is set. n must belong to the current
+// generation.
+func (n *Node[V]) updateAggregates(aggs []aggregator[V], all bool) {
+	if !n.isLeaf {
+		for i := 0; i < n.numSlots(); i++ {
+			if v := n.slot(i).node; v != nil && (all || v.dirty) {
+				n.mutableSlot(i, v).updateAggregates(aggs, all)
+			}
+		}
+	}
+	if len(n.aggs) != len(aggs) {
+		n.aggs = make([]interface{}, len(aggs))
+	}
+	for i, ag := range aggs {
+		n.aggs[i] = ag.aggregate(n)
+	}
+	n.dirty = false
+}
@@ -0,0 +1,149 @@
+package qthc
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+// valueSum is the sum of the values, firstCoordMin the minimum of the first
+// coordinate of the keys.
+var (
+	valueSum      = Monoid[int, int]{0, func(e *Entry[int]) int { return e.Value() }, func(a, b int) int { return a + b }}
+	firstCoordMin = Monoid[int, float64]{math.Inf(1), func(e *Entry[int]) float64 { return e.Coord(0) }, math.Min}
+)
+
+// checkAggregates compares the aggregates of random windows with a fold over
+// the entries that SearchIntersect() returns.
+func checkAggregates(t *testing.T, r *rand.Rand, qt *QuadTree[int], sum *Aggregator[int, int], min0 *Aggregator[int, float64], op string) {
+	t.Helper()
+	for q := 0; q < 20; q++ {
+		min, max := make([]float64, qt.dim), make([]float64, qt.dim)
+		for d := range min {
+			a, b := r.Float64(), r.Float64()
+			min[d], max[d] = math.Min(a, b), math.Max(a, b)
+			if q == 0 {
+				min[d], max[d] = math.Inf(-1), math.Inf(1)
+			}
+		}
+		s, m := 0, math.Inf(1)
+		for it := qt.SearchIntersect(min, max); it.HasNext(); {
+			e := it.Next()
+			s += e.Value()
+			m = math.Min(m, e.Coord(0))
+		}
+		if got := sum.Aggregate(min, max); got != s {
+			t.Fatalf("%d dimensions, after %s: sum is %d, want %d", qt.dim, op, got, s)
+		}
+		if got := min0.Aggregate(min, max); got != m {
+			t.Fatalf("%d dimensions, after %s: minimum is %v, want %v", qt.dim, op, got, m)
+		}
+	}
+}
+
+func TestAggregateMatchesSearchIntersect(t *testing.T) {
+	for _, policy := range []DuplicatePolicy{Multimap, Map} {
+		for _, dim := range []int{1, 2, 3, 12} {
+			r := rand.New(rand.NewSource(int64(dim)))
+			//coarse keys to get duplicates
+			key := func() []float64 {
+				k := make([]float64, dim)
+				for d := range k {
+					k[d] = float64(r.Intn(16)) / 16
+				}
+				return k
+			}
+			qt := New[int](dim, WithMaxNodeSize(4), WithDuplicatePolicy(policy))
+			for i := 0; i < 100; i++ {
+				qt.Insert(key(), i)
+			}
+			sum, min0 := AddAggregator(qt, valueSum), AddAggregator(qt, firstCoordMin)
+			checkAggregates(t, r, qt, sum, min0, "AddAggregator")
+
+			var entries []*Entry[int]
+			for i := 100; i < 1500; i++ {
+				e, _ := qt.Insert(key(), i)
+				entries = append(entries, e)
+			}
+			checkAggregates(t, r, qt, sum, min0, "Insert")
+			for i := 0; i < 200; i++ {
+				qt.Remove(key())
+			}
+			checkAggregates(t, r, qt, sum, min0, "Remove")
+			for i := 0; i < 200; i++ {
+				qt.Update(key(), key())
+			}
+			checkAggregates(t, r, qt, sum, min0, "Update")
+			for _, e := range entries[:300] {
+				qt.MoveEntry(e, key())
+			}
+			checkAggregates(t, r, qt, sum, min0, "MoveEntry")
+			min, max := make([]float64, dim), make([]float64, dim)
+			for d := range max {
+				max[d] = 0.5
+			}
+			qt.RemoveIf(min, max, func(e *Entry[int]) bool { return e.Value()%3 == 0 })
+			checkAggregates(t, r, qt, sum, min0, "RemoveIf")
+			qt.Compact()
+			checkAggregates(t, r, qt, sum, min0, "Compact")
+
+			points, values := make([][]float64, 1000), make([]int, 1000)
+			for i := range points {
+				points[i], values[i] = key(), i
+			}
+			qt.Clear()
+			if err := qt.BulkLoad(points, values); err != nil {
+				t.Fatal(err)
+			}
+			checkAggregates(t, r, qt, sum, min0, "BulkLoad")
+			if err := qt.Validate(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+func TestAggregateConcurrently(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	qt := New[int](2, WithMaxNodeSize(4))
+	sum := AddAggregator(qt, valueSum)
+	var entries []*Entry[int]
+	for i := 0; i < 2000; i++ {
+		e, _ := qt.Insert(randomPoint(r, 2), i)
+		entries = append(entries, e)
+	}
+	for _, e := range entries[:500] {
+		qt.MoveEntry(e, randomPoint(r, 2))
+	}
+	for _, e := range entries[500:1000] {
+		qt.RemoveEntry(e)
+	}
+	min, max := []float64{0.25, 0.25}, []float64{0.75, 0.75}
+	want := 0
+	for _, e := range entries {
+		if e.enclosed(min, max) && qt.Contains(e.Point()) {
+			want += e.Value()
+		}
+	}
+
+	//queries only read the tree, the race detector checks that
+	root := qt.root
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				if got := sum.Aggregate(min, max); got != want {
+					t.Errorf("Aggregate returns %d, want %d", got, want)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if qt.root != root || qt.root.dirty {
+		t.Error("Aggregate changes the tree")
+	}
+}
@@ -0,0 +1,180 @@
+package qthc
+
+import (
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+const (
+	benchDim   = 3
+	benchSize  = 100000
+	benchWidth = 0.1
+	//the number of query windows
+	benchWindows = 1024
+)
+
+var (
+	benchOnce sync.Once
+	benchQt   *QuadTree[int]
+	benchMins [][]float64
+	benchMaxs [][]float64
+)
+
+func randomPoint(r *rand.Rand, dim int) []float64 {
+	p := make([]float64, dim)
+	for d := range p {
+		p[d] = r.Float64()
+	}
+	return p
+}
+
+// benchTree returns a tree with random entries in [0, 1] and the query
+// windows, the same for every benchmark.
+func benchTree() (*QuadTree[int], [][]float64, [][]float64) {
+	benchOnce.Do(func() {
+		r := rand.New(rand.NewSource(1))
+		benchQt = New[int](benchDim)
+		for i := 0; i < benchSize; i++ {
+			benchQt.Insert(randomPoint(r, benchDim), i)
+		}
+		benchMins = make([][]float64, benchWindows)
+		benchMaxs = make([][]float64, benchWindows)
+		for i := range benchMins {
+			benchMins[i] = randomPoint(r, benchDim)
+			benchMaxs[i] = make([]float64, benchDim)
+			for d := range benchMins[i] {
+				benchMins[i][d] *= 1 - benchWidth
+				benchMaxs[i][d] = benchMins[i][d] + benchWidth
+			}
+		}
+	})
+	return benchQt, benchMins, benchMaxs
+}
+
+func benchQuery(b *testing.B, query func(min, max []float64) int) {
+	_, mins, maxs := benchTree()
+	b.ReportAllocs()
+	b.ResetTimer()
+	found := 0
+	for i := 0; i < b.N; i++ {
+		found += query(mins[i%len(mins)], maxs[i%len(maxs)])
+	}
+	b.ReportMetric(float64(found)/float64(b.N), "entries/op")
+}
+
+func BenchmarkSearchIntersect(b *testing.B) {
+	qt, _, _ := benchTree()
+	benchQuery(b, func(min, max []float64) int {
+		c := 0
+		for it := qt.SearchIntersect(min, max); it.HasNext(); it.Next() {
+			c++
+		}
+		return c
+	})
+}
+
+func BenchmarkSearchIntersectReset(b *testing.B) {
+	qt, mins, maxs := benchTree()
+	it := qt.SearchIntersect(mins[0], maxs[0])
+	benchQuery(b, func(min, max []float64) int {
+		c := 0
+		for it.Reset(min, max); it.HasNext(); it.Next() {
+			c++
+		}
+		return c
+	})
+}
+
+func BenchmarkIntersect(b *testing.B) {
+	qt, _, _ := benchTree()
+	benchQuery(b, func(min, max []float64) int {
+		c := 0
+		for range qt.Intersect(min, max) {
+			c++
+		}
+		return c
+	})
+}
+
+func BenchmarkVisitIntersect(b *testing.B) {
+	qt, _, _ := benchTree()
+	benchQuery(b, func(min, max []float64) int {
+		c := 0
+		qt.VisitIntersect(min, max, func(e *Entry[int]) bool {
+			c++
+			return true
+		})
+		return c
+	})
+}
+
+func BenchmarkCount(b *testing.B) {
+	qt, _, _ := benchTree()
+	benchQuery(b, func(min, max []float64) int {
+		return qt.Count(min, max)
+	})
+}
+
+// benchBuild measures building a tree from benchSize random points.
+func benchBuild(b *testing.B, build func(qt *QuadTree[int], pts [][]float64, vals []int)) {
+	r := rand.New(rand.NewSource(1))
+	pts := make([][]float64, benchSize)
+	vals := make([]int, benchSize)
+	for i := range pts {
+		pts[i] = randomPoint(r, benchDim)
+		vals[i] = i
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		build(New[int](benchDim), pts, vals)
+	}
+}
+
+func BenchmarkInsert(b *testing.B) {
+	benchBuild(b, func(qt *QuadTree[int], pts [][]float64, vals []int) {
+		for i, p := range pts {
+			qt.Insert(p, vals[i])
+		}
+	})
+}
+
+func BenchmarkBulkLoad(b *testing.B) {
+	benchBuild(b, func(qt *QuadTree[int], pts [][]float64, vals []int) {
+		qt.BulkLoad(pts, vals)
+	})
+}
+
+func TestQueriesDontAllocate(t *testing.T) {
+	//dense and sparse directory nodes
+	for _, dim := range []int{2, 12} {
+		r := rand.New(rand.NewSource(1))
+		qt := New[int](dim)
+		for i := 0; i < 5000; i++ {
+			qt.Insert(randomPoint(r, dim), i)
+		}
+		min, max := make([]float64, dim), make([]float64, dim)
+		for d := range max {
+			max[d] = 1
+		}
+		min[0], max[0], min[1], max[1] = 0.2, 0.6, 0.3, 0.5
+
+		it := qt.SearchIntersect(min, max)
+		if a := testing.AllocsPerRun(100, func() {
+			for it.Reset(min, max); it.HasNext(); it.Next() {
+			}
+		}); a != 0 {
+			t.Errorf("%d dimensions: Reset allocates %v times", dim, a)
+		}
+		//sync.Pool drops pooled items at random under the race detector
+		if a := testing.AllocsPerRun(100, func() { qt.Count(min, max) }); a != 0 && !raceEnabled {
+			t.Errorf("%d dimensions: Count allocates %v times", dim, a)
+		}
+		if a := testing.AllocsPerRun(100, func() {
+			qt.VisitIntersect(min, max, func(e *Entry[int]) bool { return true })
+		}); a != 0 {
+			t.Errorf("%d dimensions: VisitIntersect allocates %v times", dim, a)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package qthc
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+)
+
+var ErrOutOfBounds = errors.New("qthc: point is outside the bounds of the tree")
+
+// OutOfBoundsPolicy defines what happens when a point outside the domain of
+// a tree with bounds is inserted.
+type OutOfBoundsPolicy int
+
+const (
+	// Grow doubles the root until it covers the point, like trees without
+	// bounds do.
+	Grow OutOfBoundsPolicy = iota
+	// Reject refuses the point with ErrOutOfBounds, the root never changes.
+	Reject
+)
+
+// NewQuadTreeWithBounds creates an empty tree for the domain min/max. The
+// root is the smallest hypercube that is centered on the domain and covers
+// it, so all nodes partition the domain regularly (MX quadtree) instead of
+// depending on the first inserted point.
+func NewQuadTreeWithBounds[V any](min, max []float64, maxNodeSize int, oob OutOfBoundsPolicy) *QuadTree[V] {
+	return New[V](len(min), WithMaxNodeSize(maxNodeSize), WithBounds(min, max, oob))
+}
+
+// boundsBox returns the root box for the domain min/max.
+func boundsBox(min, max []float64) ([]float64, float64) {
+	if len(min) != len(max) || len(min) == 0 {
+		panic("qthc: min and max must have the same, non-zero length")
+	}
+	center := make([]float64, len(min))
+	radius := 0.0
+	for d := range min {
+		if !(min[d] <= max[d]) || math.IsInf(min[d], 0) || math.IsInf(max[d], 0) {
+			panic(fmt.Sprintf("qthc: bad bounds %v / %v in dimension %d", min[d], max[d], d))
+		}
+		center[d] = min[d] + (max[d]-min[d])/2
+		radius = math.Max(radius, (max[d]-min[d])/2)
+	}
+	if radius == 0 {
+		radius = 1
+	}
+	return center, radius
+}
+
+// Bounds returns the domain of a tree created with bounds, or nil.
+func (qt *QuadTree[V]) Bounds() (min, max []float64) {
+	if qt.domainMin == nil {
+		return nil, nil
+	}
+	return append([]float64(nil), qt.domainMin...), append([]float64(nil), qt.domainMax...)
+}
+
+// fitsBounds returns whether n can be the root of the tree. A tree that
+// rejects points outside its domain always has the domain box as root, the
+// root of a growing tree covers that box.
+func (qt *QuadTree[V]) fitsBounds(n *Node[V]) bool {
+	if qt.domainCenter == nil {
+		return true
+	}
+	if qt.oob == Reject {
+		return n.radius == qt.domainRadius && isPointEqual(n.center, qt.domainCenter)
+	}
+	for d, c := range qt.domainCenter {
+		if c-qt.domainRadius < n.center[d]-n.radius || c+qt.domainRadius > n.center[d]+n.radius {
+			return false
+		}
+	}
+	return true
+}
+
+// rebuildInBounds inserts the entries below root into a new root for the
+// domain of the tree and returns it. The tree itself doesn't change.
+func (qt *QuadTree[V]) rebuildInBounds(root *Node[V], maxNodeSize int) *Node[V] {
+	t := new(QuadTree[V])
+	*t = *qt
+	t.maxNodeSize = maxNodeSize
+	t.initializeRoot(nil)
+	for _, e := range root.appendEntries(nil) {
+		t.ensureCoverage(e)
+		t.put(e, false)
+	}
+	return t.root
+}
+
+// checkBounds returns ErrOutOfBounds if the tree rejects key.
+func (qt *QuadTree[V]) checkBounds(key []float64) error {
+	if qt.domainMin == nil || (qt.oob == Grow && !qt.logs(slog.LevelDebug)) ||
+		isPointEnclosed(key, qt.domainMin, qt.domainMax) {
+		return nil
+	}
+	if qt.oob == Grow {
+		qt.log(slog.LevelDebug, "point out of bounds, growing", slog.Any("key", key))
+		return nil
+	}
+	if qt.logs(slog.LevelWarn) {
+		qt.log(slog.LevelWarn, "point out of bounds, rejected", slog.Any("key", key))
+	}
+	return fmt.Errorf("%w: %v", ErrOutOfBounds, key)
+}
@@ -0,0 +1,142 @@
+package qthc
+
+import (
+	"bytes"
+	"errors"
+	"maps"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// boundsCorners returns the corners of the domain [0, 10] x [0, 5].
+func boundsCorners() [][]float64 {
+	return [][]float64{{0, 0}, {10, 0}, {0, 5}, {10, 5}}
+}
+
+func TestBoundsReject(t *testing.T) {
+	min, max := []float64{0, 0}, []float64{10, 5}
+	qt := New[int](2, WithMaxNodeSize(2), WithBounds(min, max, Reject))
+	for i, p := range boundsCorners() {
+		if _, err := qt.Insert(p, i); err != nil {
+			t.Fatalf("corner %v is rejected: %v", p, err)
+		}
+	}
+	for _, p := range [][]float64{{math.Nextafter(10, 11), 1}, {1, math.Nextafter(0, -1)}, {-100, -100}} {
+		if _, err := qt.Insert(p, 9); !errors.Is(err, ErrOutOfBounds) {
+			t.Errorf("insert of %v returns %v, want ErrOutOfBounds", p, err)
+		}
+	}
+	if _, _, err := qt.Update([]float64{0, 0}, []float64{11, 0}); !errors.Is(err, ErrOutOfBounds) {
+		t.Errorf("update returns %v, want ErrOutOfBounds", err)
+	}
+	if _, ok, _ := qt.Update([]float64{0, 5}, []float64{5, 5}); !ok {
+		t.Error("update to the domain edge fails")
+	}
+	if !qt.Contains([]float64{0, 0}) || !qt.Contains([]float64{5, 5}) || qt.Size() != 4 {
+		t.Fatal("rejected points changed the tree")
+	}
+	//the root is the domain box
+	if qt.root.radius != 5 || qt.root.center[0] != 5 || qt.root.center[1] != 2.5 {
+		t.Errorf("root has center %v and radius %v", qt.root.center, qt.root.radius)
+	}
+	if err := qt.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	b := New[int](2, WithBounds(min, max, Reject))
+	if err := b.BulkLoad([][]float64{{1, 1}, {1, 6}}, []int{1, 2}); !errors.Is(err, ErrOutOfBounds) || b.Size() != 0 {
+		t.Errorf("BulkLoad returns %v and loads %d entries", err, b.Size())
+	}
+}
+
+func TestBoundsGrow(t *testing.T) {
+	min, max := []float64{0, 0}, []float64{10, 5}
+	qt := New[int](2, WithMaxNodeSize(2), WithBounds(min, max, Grow))
+	var pts [][]float64
+	for i, p := range boundsCorners() {
+		qt.Insert(p, i)
+		pts = append(pts, p)
+	}
+	if qt.root.radius != 5 {
+		t.Fatalf("points inside the domain grow the root to radius %v", qt.root.radius)
+	}
+	for i, p := range [][]float64{{-1, 2}, {30, 30}, {math.Nextafter(10, 11), 5}} {
+		if _, err := qt.Insert(p, 10+i); err != nil {
+			t.Fatalf("insert of %v fails: %v", p, err)
+		}
+		pts = append(pts, p)
+	}
+	if qt.root.radius != 20 {
+		t.Errorf("root has radius %v, want 20", qt.root.radius)
+	}
+	for _, p := range pts {
+		if !qt.Contains(p) {
+			t.Errorf("%v is lost", p)
+		}
+	}
+	if err := qt.Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadFromBoundedTree(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	min, max := []float64{0, 0}, []float64{8, 8}
+	src := New[int](2, WithMaxNodeSize(3))
+	for i := 0; i < 200; i++ {
+		src.Insert([]float64{1 + r.Float64(), 1 + r.Float64()}, i)
+	}
+	data, _ := src.MarshalBinary()
+
+	for _, oob := range []OutOfBoundsPolicy{Reject, Grow} {
+		qt := New[int](2, WithMaxNodeSize(3), WithBounds(min, max, oob))
+		if _, err := qt.ReadFrom(bytes.NewReader(data)); err != nil {
+			t.Fatal(err)
+		}
+		//the stream has another root, the tree keeps the root of its
+		//domain
+		if qt.root.radius != 4 || qt.root.center[0] != 4 || qt.root.center[1] != 4 {
+			t.Errorf("root has center %v and radius %v", qt.root.center, qt.root.radius)
+		}
+		qt.Insert([]float64{7, 7}, 200)
+		if qt.root.radius != 4 {
+			t.Errorf("insert into the domain grows the root to radius %v", qt.root.radius)
+		}
+		qt.Remove([]float64{7, 7})
+		if !maps.Equal(contents(qt), contents(src)) {
+			t.Error("the tree differs from the stream")
+		}
+		if err := qt.Validate(); err != nil {
+			t.Fatal(err)
+		}
+		//streams of trees with the same bounds are taken as they are
+		data2, _ := qt.MarshalBinary()
+		qt2 := New[int](2, WithBounds(min, max, oob))
+		qt2.ReadFrom(bytes.NewReader(data2))
+		if data3, _ := qt2.MarshalBinary(); !bytes.Equal(data2, data3) {
+			t.Error("the stream of a tree with the same bounds changes")
+		}
+	}
+
+	src.Insert([]float64{9, 1}, 200)
+	data, _ = src.MarshalBinary()
+	qt := New[int](2, WithBounds(min, max, Reject))
+	qt.Insert([]float64{1, 1}, 1)
+	if _, err := qt.ReadFrom(bytes.NewReader(data)); !errors.Is(err, ErrOutOfBounds) {
+		t.Errorf("ReadFrom returns %v, want ErrOutOfBounds", err)
+	}
+	if qt.Size() != 1 || !qt.Contains([]float64{1, 1}) {
+		t.Error("failed ReadFrom changed the tree")
+	}
+	grow := New[int](2, WithBounds(min, max, Grow))
+	if _, err := grow.ReadFrom(bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	if !maps.Equal(contents(grow), contents(src)) {
+		t.Error("the growing tree differs from the stream")
+	}
+	if err := grow.Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
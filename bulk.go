@@ -0,0 +1,349 @@
+package qthc
+
+import (
+	"errors"
+	"sort"
+)
+
+var (
+	ErrTreeNotEmpty   = errors.New("qthc: tree is not empty")
+	ErrLengthMismatch = errors.New("qthc: number of points and values differ")
+)
+
+// BulkLoad fills an empty tree with the given points and values.
+//
+// The root box is computed once, in the same way as by incremental
+// insertion of the points in the given order. The entries are then sorted by
+// their hypercube address (Z-order) and the nodes are built directly. The
+// resulting tree is identical to inserting the points one by one, including
+// the order of entries in leaf nodes. In map mode an entry is created for
+// the first of several identical points and holds the value of the last one.
+// If the root grows past points that lie on its upper boundary, which moves
+// them to another quadrant, or if growing the root changes which nodes are
+// deeper than the maximum depth, the points are inserted one by one instead.
+// If any of the points is invalid or rejected by the tree, nothing is
+// loaded.
+//
+// Entries, nodes and the value and key arrays of leaves are allocated in
+// blocks. A block stays in memory as long as the tree references any part
+// of it, so removing most entries afterwards frees less memory than
+// expected. Compact() packs the keys but keeps the entries and their blocks.
+func (qt *QuadTree[V]) BulkLoad(points [][]float64, values []V) error {
+	if len(points) != len(values) {
+		return ErrLengthMismatch
+	}
+	if qt.size > 0 {
+		return ErrTreeNotEmpty
+	}
+	for _, p := range points {
+		if err := qt.checkKey(p); err != nil {
+			return err
+		}
+	}
+	if qt.policy == Map {
+		idx := mergeDuplicates(points)
+		if len(idx) < len(points) {
+			p2 := make([][]float64, len(idx))
+			v2 := make([]V, len(idx))
+			for i, k := range idx {
+				p2[i] = points[k[0]]
+				v2[i] = values[k[1]]
+			}
+			points, values = p2, v2
+		}
+	}
+	if len(points) == 0 {
+		return nil
+	}
+	for _, p := range points {
+		if err := qt.checkBounds(p); err != nil {
+			return err
+		}
+	}
+
+	qt.initializeRoot(points[0])
+	center := qt.root.center
+	radius := qt.root.radius
+	//chain holds the position of each old root in the root that replaces it
+	var chain []hcPos
+	max := append([]float64(nil), points[0]...)
+	for _, p := range points {
+		for !isPointEnclosedFromCenter(p, center, radius) {
+			var pos hcPos
+			center, radius, pos = growBox(center, radius, p, nil)
+			for d := range max {
+				if !pos.isSet(qt.dim, d) && max[d] >= center[d] {
+					//see takeUpperBoundary()
+					return qt.insertAll(points, values)
+				}
+			}
+			chain = append(chain, pos)
+		}
+		for d, x := range p {
+			if x > max[d] {
+				max[d] = x
+			}
+		}
+	}
+
+	b := new(bulkLoader[V])
+	b.maxNodeSize = qt.maxNodeSize
+	b.maxDepth = qt.maxDepth
+	b.dim = qt.dim
+	b.w = hcWords(qt.dim)
+	b.gen = qt.gen
+	b.chain = chain
+	//entries and nodes are allocated in blocks, this is much cheaper than
+	//allocating them one by one
+	b.entries = make([][]Entry[V], (len(points)+bulkBlockSize-1)/bulkBlockSize)
+	for i := range b.entries {
+		b.entries[i] = make([]Entry[V], min(bulkBlockSize, len(points)-i*bulkBlockSize))
+	}
+	for i := range points {
+		e := b.entry(int32(i))
+		e.point = points[i]
+		e.value = values[i]
+	}
+	if qt.keys == CopyKeys {
+		b.keys = make([]float64, len(points)*qt.dim)
+	}
+	b.values = make([]*Entry[V], len(points))
+	for i := 0; i < 2; i++ {
+		b.idx[i] = make([]int32, len(points))
+		b.pos[i] = make([]uint64, len(points)*b.w)
+	}
+	for i := range b.idx[0] {
+		b.idx[0][i] = int32(i)
+	}
+	root := b.newNode(center, radius)
+	b.build(root, 0, len(points), 0, true)
+	if b.fallback {
+		return qt.insertAll(points, values)
+	}
+
+	qt.root = root
+	qt.size = len(points)
+	qt.updateAggregates()
+	return nil
+}
+
+// insertAll inserts the valid points one by one into the empty tree.
+func (qt *QuadTree[V]) insertAll(points [][]float64, values []V) error {
+	qt.root = nil
+	for i, p := range points {
+		qt.insert(p, values[i])
+	}
+	return nil
+}
+
+// bulkLoader sorts indexes of entries rather than the entries themselves,
+// which avoids write barriers and improves locality.
+//
+// The index and position buffers are used in turns: a node at an even depth
+// sorts its region of idx[0] into idx[1], nodes at odd depths sort from
+// idx[1] into idx[0]. A node only uses the region of its own entries, so
+// recursion doesn't overwrite data that is still needed by the parent.
+type bulkLoader[V any] struct {
+	maxNodeSize, dim, w int
+	maxDepth            int
+	gen                 uint64
+	entries             [][]Entry[V]
+	//positions of the grown roots, see build()
+	chain []hcPos
+	//set if the tree differs from incremental insertion
+	fallback bool
+	//backing array for the values of leaf nodes
+	values []*Entry[V]
+	nodes  []Node[V]
+	coords []float64
+	//copied keys in the order of the leaves, nil for BorrowKeys
+	keys  []float64
+	idx   [2][]int32
+	pos   [2][]uint64
+	count []int
+}
+
+// build fills node with the entries at [off, off+n) of the current index
+// buffer. It follows the same rules as tryPut(): a node only becomes a
+// directory node if it overflows and splitting can help, quadrants with a
+// single entry store the entry directly.
+//
+// Nodes that have been the root before it grew are directory nodes with the
+// previous root as a sub node, see ensureCoverage(). Such a node is
+// chained, the previous root is at position chain[len(chain)-depth-1].
+// They move the nodes below them deeper while the points are inserted, so
+// a node may be split by incremental insertion before it falls below the
+// maximum depth. build() sets fallback in that case.
+func (b *bulkLoader[V]) build(node *Node[V], off, n, depth int, chained bool) {
+	src := b.idx[depth&1][off : off+n]
+	grown := chained && depth < len(b.chain)
+	if !grown && (n <= b.maxNodeSize || depth > b.maxDepth || b.allPointsIdentical(src)) {
+		if n > b.maxNodeSize && depth > b.maxDepth && depth-len(b.chain) <= b.maxDepth && !b.allPointsIdentical(src) {
+			b.fallback = true
+		}
+		node.values = b.values[off : off+n : off+n]
+		for i, k := range src {
+			node.values[i] = b.entry(k)
+			node.adopt(node.values[i])
+			b.storeKey(node.values[i], off+i)
+		}
+		if b.keys != nil {
+			node.keys = b.keys[off*b.dim : (off+n)*b.dim : (off+n)*b.dim]
+		}
+		node.nValues = n
+		return
+	}
+
+	node.clearValues()
+	node.isLeaf = false
+	node.nEntries = n
+	b.sortByPosition(node, off, n, depth)
+
+	w := b.w
+	idx := b.idx[(depth+1)&1]
+	pos := b.pos[(depth+1)&1]
+	nSubs := 1
+	for i := off + 1; i < off+n; i++ {
+		if hcPos(pos[i*w:(i+1)*w]).compare(pos[(i-1)*w:i*w]) != 0 {
+			nSubs++
+		}
+	}
+	node.initSubs(nSubs)
+
+	var prev hcPos
+	if grown {
+		prev = b.chain[len(b.chain)-depth-1]
+	}
+	for start := off; start < off+n && !b.fallback; {
+		p := hcPos(pos[start*w : (start+1)*w])
+		end := start + 1
+		for end < off+n && p.compare(pos[end*w:(end+1)*w]) == 0 {
+			end++
+		}
+		isPrev := grown && p.compare(prev) == 0
+		if end-start == 1 && !isPrev {
+			e := b.entry(idx[start])
+			b.storeKey(e, start)
+			node.setSub(p, entryChild(e))
+			node.nValues++
+		} else {
+			sub := b.newSub(node, p)
+			node.setSub(p, nodeChild(sub))
+			b.build(sub, start, end-start, depth+1, isPrev)
+		}
+		start = end
+	}
+}
+
+func (b *bulkLoader[V]) entry(k int32) *Entry[V] {
+	return &b.entries[k/bulkBlockSize][k%bulkBlockSize]
+}
+
+// storeKey copies the point of e to position i of the key array, so the
+// keys of each leaf are contiguous.
+func (b *bulkLoader[V]) storeKey(e *Entry[V], i int) {
+	if b.keys == nil {
+		return
+	}
+	p := b.keys[i*b.dim : (i+1)*b.dim : (i+1)*b.dim]
+	copy(p, e.point)
+	e.point = p
+}
+
+const bulkBlockSize = 256
+
+func (b *bulkLoader[V]) newNode(center []float64, radius float64) *Node[V] {
+	if len(b.nodes) == 0 {
+		b.nodes = make([]Node[V], bulkBlockSize)
+	}
+	n := &b.nodes[0]
+	b.nodes = b.nodes[1:]
+	n.center = center
+	n.radius = radius
+	n.isLeaf = true
+	n.dirty = true
+	n.gen = b.gen
+	return n
+}
+
+// newSub works like createSubForEntry().
+func (b *bulkLoader[V]) newSub(node *Node[V], subNodePos hcPos) *Node[V] {
+	if len(b.coords) < b.dim {
+		b.coords = make([]float64, bulkBlockSize*b.dim)
+	}
+	centerSub := b.coords[:b.dim:b.dim]
+	b.coords = b.coords[b.dim:]
+	radiusSub := node.radius / 2.0
+	for d := 0; d < b.dim; d++ {
+		if subNodePos.isSet(b.dim, d) {
+			centerSub[d] = node.center[d] + radiusSub
+		} else {
+			centerSub[d] = node.center[d] - radiusSub
+		}
+	}
+	return b.newNode(centerSub, radiusSub)
+}
+
+// sortByPosition sorts the entries at [off, off+n) by their hypercube
+// position in node, entries in the same quadrant keep their order. The
+// result is written to the other index and position buffers.
+func (b *bulkLoader[V]) sortByPosition(node *Node[V], off, n, depth int) {
+	w := b.w
+	src := b.idx[depth&1][off : off+n]
+	pos := b.pos[depth&1][off*w : (off+n)*w]
+	dst := b.idx[(depth+1)&1][off : off+n]
+	dstPos := b.pos[(depth+1)&1][off*w : (off+n)*w]
+	for i, k := range src {
+		node.calcSubPosition(b.entry(k).point, pos[i*w:(i+1)*w])
+	}
+
+	if w == 1 && b.dim <= maxDenseDim && 1<<uint(b.dim) <= 4*n {
+		//counting sort
+		if b.count == nil {
+			b.count = make([]int, 1<<uint(b.dim))
+		}
+		count := b.count
+		for i := range count {
+			count[i] = 0
+		}
+		for i := 0; i < n; i++ {
+			count[pos[i]]++
+		}
+		sum := 0
+		for i := range count {
+			c := count[i]
+			count[i] = sum
+			sum += c
+		}
+		for i := 0; i < n; i++ {
+			k := count[pos[i]]
+			count[pos[i]]++
+			dst[k] = src[i]
+			dstPos[k] = pos[i]
+		}
+		return
+	}
+
+	//dst is used to hold the permutation
+	for i := range dst {
+		dst[i] = int32(i)
+	}
+	sort.SliceStable(dst, func(i, j int) bool {
+		pi := hcPos(pos[int(dst[i])*w : (int(dst[i])+1)*w])
+		return pi.compare(pos[int(dst[j])*w:(int(dst[j])+1)*w]) < 0
+	})
+	for i := 0; i < n; i++ {
+		k := int(dst[i])
+		copy(dstPos[i*w:(i+1)*w], pos[k*w:(k+1)*w])
+		dst[i] = src[k]
+	}
+}
+
+func (b *bulkLoader[V]) allPointsIdentical(idx []int32) bool {
+	for i := 1; i < len(idx); i++ {
+		if !b.entry(idx[0]).equals(b.entry(idx[i])) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,79 @@
+package qthc
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+// checkBulkLoad compares a bulk loaded tree with a tree built by inserting
+// the points one by one.
+func checkBulkLoad(t *testing.T, dim int, pts [][]float64, opts ...Option) {
+	t.Helper()
+	vals := make([]int, len(pts))
+	for i := range vals {
+		vals[i] = i
+	}
+	bulk := New[int](dim, opts...)
+	if err := bulk.BulkLoad(pts, vals); err != nil {
+		t.Fatal(err)
+	}
+	inc := New[int](dim, opts...)
+	for i := range pts {
+		inc.Insert(pts[i], vals[i])
+	}
+	if err := bulk.Validate(); err != nil {
+		t.Fatalf("%d dimensions: %v", dim, err)
+	}
+	b1, _ := bulk.MarshalBinary()
+	b2, _ := inc.MarshalBinary()
+	if !bytes.Equal(b1, b2) {
+		t.Fatalf("%d dimensions: bulk loaded tree differs from incremental insertion", dim)
+	}
+}
+
+func TestBulkLoadMatchesInsert(t *testing.T) {
+	r := rand.New(rand.NewSource(12))
+	for _, dim := range []int{1, 2, 3, 12, 70} {
+		for _, size := range []int{1, 2, 3, 5, 10} {
+			var pts, grid [][]float64
+			for i := 0; i < 2000; i++ {
+				pts = append(pts, randomPoint(r, dim))
+				//points on node boundaries and duplicates
+				grid = append(grid, gridPoint(r, dim, 16))
+			}
+			//the root grows several times
+			for d := range pts[0] {
+				pts[0][d] *= 0.001
+			}
+			min, max := make([]float64, dim), make([]float64, dim)
+			for d := range max {
+				max[d] = 16
+			}
+			checkBulkLoad(t, dim, pts, WithMaxNodeSize(size))
+			checkBulkLoad(t, dim, grid, WithMaxNodeSize(size))
+			checkBulkLoad(t, dim, pts, WithMaxNodeSize(size), WithBounds(min, max, Reject))
+			checkBulkLoad(t, dim, grid, WithMaxNodeSize(size), WithBounds(min, max, Reject))
+			checkBulkLoad(t, dim, grid, WithMaxNodeSize(size), WithDuplicatePolicy(Map))
+			checkBulkLoad(t, dim, pts, WithMaxNodeSize(size), WithMaxDepth(2))
+		}
+	}
+}
+
+func TestBulkLoadErrors(t *testing.T) {
+	qt := New[int](2)
+	if err := qt.BulkLoad([][]float64{{1, 2}}, nil); err != ErrLengthMismatch {
+		t.Errorf("got %v, want ErrLengthMismatch", err)
+	}
+	if err := qt.BulkLoad([][]float64{{1, 2}, {1}}, []int{1, 2}); !errors.Is(err, ErrDimensionMismatch) {
+		t.Errorf("got %v, want ErrDimensionMismatch", err)
+	}
+	if qt.Size() != 0 {
+		t.Fatalf("failed load added %d entries", qt.Size())
+	}
+	qt.Insert([]float64{1, 2}, 1)
+	if err := qt.BulkLoad([][]float64{{3, 4}}, []int{2}); err != ErrTreeNotEmpty {
+		t.Errorf("got %v, want ErrTreeNotEmpty", err)
+	}
+}
@@ -0,0 +1,33 @@
+package qthc
+
+import (
+	"bytes"
+	"encoding/gob"
+)
+
+// ValueCodec converts the values of a tree to and from bytes for
+// serialization, see QuadTree.WriteTo(). UnmarshalValue must not keep a
+// reference to data.
+type ValueCodec[V any] interface {
+	MarshalValue(v V) ([]byte, error)
+	UnmarshalValue(data []byte) (V, error)
+}
+
+// GobCodec encodes values with encoding/gob. It is the default codec, it
+// works with most types but is slow and verbose because every value carries
+// its own type information.
+type GobCodec[V any] struct{}
+
+func (GobCodec[V]) MarshalValue(v V) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (GobCodec[V]) UnmarshalValue(data []byte) (V, error) {
+	var v V
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&v)
+	return v, err
+}
@@ -0,0 +1,170 @@
+package qthc
+
+// Compact restructures the tree after removals. Directory nodes whose
+// entries fit into a leaf (or whose points are all identical) become
+// leaves, sub nodes with a single entry are replaced by the entry and empty
+// sub nodes are removed. If the entries occupy only a small part of the
+// root, the tree is rebuilt under the smallest root box that covers them.
+// The result has the same depth as a tree that is built from the remaining
+// entries. Trees with bounds keep a root that covers their domain. Copied
+// keys are packed into one coordinate array per node.
+func (qt *QuadTree[V]) Compact() {
+	qt.removed = 0
+	if qt.root == nil {
+		return
+	}
+	if qt.size == 0 {
+		qt.root = nil
+		return
+	}
+	entries := qt.root.appendEntries(make([]*Entry[V], 0, qt.size))
+	if qt.shrinks(entries) {
+		qt.initializeRoot(entries[0].point)
+		for _, e := range entries {
+			qt.ensureCoverage(e)
+			qt.put(e, false)
+		}
+	} else {
+		qt.mutableRoot()
+		qt.root.compact(qt.maxNodeSize, qt.nodeEvents())
+	}
+	if qt.keys == CopyKeys {
+		qt.root.packKeys()
+	}
+	qt.updateAggregates()
+}
+
+// shrinks returns whether a new tree would have a smaller root for the
+// entries. The root box is computed as by incremental insertion, see
+// BulkLoad().
+func (qt *QuadTree[V]) shrinks(entries []*Entry[V]) bool {
+	root := qt.root
+	qt.initializeRoot(entries[0].point)
+	center, radius := qt.root.center, qt.root.radius
+	qt.root = root
+	for _, e := range entries {
+		for !isPointEnclosedFromCenter(e.point, center, radius) && radius < qt.root.radius {
+			center, radius, _ = growBox(center, radius, e.point, nil)
+		}
+	}
+	return radius < qt.root.radius
+}
+
+// SetAutoCompact makes the tree call Compact() whenever the number of
+// removed or moved entries since the last compaction exceeds
+// fraction * Size(). 0 disables automatic compaction, this is the default.
+func (qt *QuadTree[V]) SetAutoCompact(fraction float64) {
+	qt.autoCompact = fraction
+}
+
+// afterRemove is called when n entries were removed or moved. It updates the
+// aggregates and compacts the tree if necessary.
+func (qt *QuadTree[V]) afterRemove(n int) {
+	qt.updateAggregates()
+	if qt.autoCompact <= 0 {
+		return
+	}
+	qt.removed += n
+	if float64(qt.removed) > qt.autoCompact*float64(qt.size) {
+		qt.Compact()
+	}
+}
+
+// compact compacts the sub tree of n, see QuadTree.Compact(). n must belong
+// to the current generation. It returns the number of entries in the sub
+// tree, one of the entries and whether all entries have identical points.
+func (n *Node[V]) compact(maxNodeSize int, ev nodeEvent[V]) (int, *Entry[V], bool) {
+	if n.isLeaf {
+		if n.nValues == 0 {
+			return 0, nil, true
+		}
+		return n.nValues, n.values[0], n.areAllPointsIdentical(n.values[0])
+	}
+
+	n.dirty = true
+	count := 0
+	var first *Entry[V]
+	identical := true
+	for _, s := range n.occupiedSlots() {
+		c := 1
+		e := s.sub.entry
+		ident := true
+		if e == nil {
+			sub := n.mutableSub(s.pos, s.sub.node)
+			c, e, ident = sub.compact(maxNodeSize, ev)
+			if c == 0 {
+				n.setSub(s.pos, child[V]{})
+				continue
+			}
+			if c == 1 {
+				n.setSub(s.pos, entryChild(e))
+				n.nValues++
+			}
+		}
+		if first == nil {
+			first = e
+		}
+		identical = identical && ident && first.equals(e)
+		count += c
+	}
+
+	n.nEntries = count
+	if count <= maxNodeSize || identical {
+		values := make([]*Entry[V], 0, max(count, 2))
+		values = n.appendEntries(values)
+		n.clearSubs()
+		n.isLeaf = true
+		n.values = values[:cap(values)]
+		n.nValues = count
+		for _, e := range values {
+			n.adopt(e)
+		}
+		if ev != nil {
+			ev("nodes merged", n)
+		}
+	}
+	return count, first, identical
+}
+
+// slotRef is an occupied slot of a directory node.
+type slotRef[V any] struct {
+	pos hcPos
+	sub child[V]
+}
+
+// occupiedSlots returns the occupied slots of n. Unlike slot(), the result
+// stays valid while slots change, which may switch the storage of n.
+func (n *Node[V]) occupiedSlots() []slotRef[V] {
+	slots := make([]slotRef[V], 0, n.nSubs)
+	w := hcWords(len(n.center))
+	for i := 0; i < n.numSlots(); i++ {
+		sub := n.slot(i)
+		if sub.isEmpty() {
+			continue
+		}
+		pos := make(hcPos, w)
+		if n.subs != nil {
+			pos[0] = uint64(i)
+		} else {
+			copy(pos, n.slotPos(i))
+		}
+		slots = append(slots, slotRef[V]{pos, sub})
+	}
+	return slots
+}
+
+// appendEntries appends all entries of the sub tree of n to r.
+func (n *Node[V]) appendEntries(r []*Entry[V]) []*Entry[V] {
+	if n.isLeaf {
+		return append(r, n.values[:n.nValues]...)
+	}
+	for i := 0; i < n.numSlots(); i++ {
+		c := n.slot(i)
+		if v := c.node; v != nil {
+			r = v.appendEntries(r)
+		} else if v := c.entry; v != nil {
+			r = append(r, v)
+		}
+	}
+	return r
+}
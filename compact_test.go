@@ -0,0 +1,150 @@
+package qthc
+
+import (
+	"bytes"
+	"maps"
+	"math/rand"
+	"testing"
+)
+
+// orderOf returns the entries of qt in the order of All(), which is the
+// order in which Compact() inserts them again.
+func orderOf(qt *QuadTree[int]) ([][]float64, []int) {
+	var keys [][]float64
+	var values []int
+	for k, v := range qt.All() {
+		keys = append(keys, k)
+		values = append(values, v)
+	}
+	return keys, values
+}
+
+// checkCompacted checks that qt is the same as a tree with the given
+// options that is built from the entries in the given order.
+func checkCompacted(t *testing.T, qt *QuadTree[int], keys [][]float64, values []int, opts ...Option) {
+	t.Helper()
+	if err := qt.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	fresh := New[int](qt.dim, opts...)
+	for i, k := range keys {
+		fresh.Insert(k, values[i])
+	}
+	if s1, s2 := qt.Stats(), fresh.Stats(); s1.MaxDepth != s2.MaxDepth {
+		t.Errorf("depth is %d, a new tree has depth %d", s1.MaxDepth, s2.MaxDepth)
+	}
+	b1, _ := qt.MarshalBinary()
+	b2, _ := fresh.MarshalBinary()
+	if !bytes.Equal(b1, b2) {
+		t.Error("compacted tree differs from a new tree")
+	}
+}
+
+func TestCompactShrinksRoot(t *testing.T) {
+	for _, dim := range []int{1, 2, 3, 12} {
+		r := rand.New(rand.NewSource(int64(dim)))
+		qt := New[int](dim, WithMaxNodeSize(4))
+		kept := make(map[int]bool)
+		var far []*Entry[int]
+		for i := 0; i < 3000; i++ {
+			p := randomPoint(r, dim)
+			if i%10 == 0 {
+				for d := range p {
+					p[d] *= 1000
+				}
+			}
+			e, _ := qt.Insert(p, i)
+			if i%10 == 0 {
+				far = append(far, e)
+			} else {
+				kept[i] = true
+			}
+		}
+		radius := qt.root.radius
+		for _, e := range far {
+			qt.RemoveEntry(e)
+		}
+		keys, values := orderOf(qt)
+		qt.Compact()
+		if qt.root.radius*256 > radius {
+			t.Errorf("%d dimensions: root radius is %v, was %v", dim, qt.root.radius, radius)
+		}
+		got := make(map[int]bool)
+		for _, v := range qt.All() {
+			got[v] = true
+		}
+		if !maps.Equal(got, kept) {
+			t.Fatalf("%d dimensions: Compact changes the entries", dim)
+		}
+		checkCompacted(t, qt, keys, values, WithMaxNodeSize(4))
+	}
+}
+
+func TestCompactBoundedTree(t *testing.T) {
+	opts := []Option{WithMaxNodeSize(4), WithBounds([]float64{0, 0}, []float64{1, 1}, Reject)}
+	r := rand.New(rand.NewSource(1))
+	qt := New[int](2, opts...)
+	var removed []*Entry[int]
+	for i := 0; i < 3000; i++ {
+		e, _ := qt.Insert(randomPoint(r, 2), i)
+		if i%10 != 0 {
+			removed = append(removed, e)
+		}
+	}
+	for _, e := range removed {
+		qt.RemoveEntry(e)
+	}
+	keys, values := orderOf(qt)
+	qt.Compact()
+	if qt.root.radius != 0.5 {
+		t.Errorf("root radius is %v, want 0.5", qt.root.radius)
+	}
+	checkCompacted(t, qt, keys, values, opts...)
+}
+
+func TestAutoCompact(t *testing.T) {
+	moves := map[string]func(qt *QuadTree[int], e *Entry[int], key []float64){
+		"Update": func(qt *QuadTree[int], e *Entry[int], key []float64) {
+			qt.Update(e.Point(), key)
+		},
+		"MoveEntry": func(qt *QuadTree[int], e *Entry[int], key []float64) {
+			qt.MoveEntry(e, key)
+		},
+	}
+	for name, move := range moves {
+		//twin gets the same moves but is compacted explicitly
+		r := rand.New(rand.NewSource(1))
+		qt := New[int](2, WithMaxNodeSize(4))
+		twin := New[int](2, WithMaxNodeSize(4))
+		var entries, twins []*Entry[int]
+		for i := 0; i < 1000; i++ {
+			p := []float64{r.Float64() * 1000, r.Float64() * 1000}
+			e, _ := qt.Insert(p, i)
+			entries = append(entries, e)
+			e, _ = twin.Insert(p, i)
+			twins = append(twins, e)
+		}
+		qt.SetAutoCompact(0.5)
+		//the tree is compacted after the 501st move
+		for i := 0; i <= 500; i++ {
+			key := []float64{r.Float64(), r.Float64()}
+			move(qt, entries[i], key)
+			move(twin, twins[i], key)
+			if i < 500 && qt.removed != i+1 {
+				t.Fatalf("%s: %d moves are counted after %d moves", name, qt.removed, i+1)
+			}
+		}
+		if qt.removed != 0 {
+			t.Fatalf("%s: the tree isn't compacted", name)
+		}
+		twin.Compact()
+		if err := qt.Validate(); err != nil {
+			t.Fatal(err)
+		}
+		b1, _ := qt.MarshalBinary()
+		b2, _ := twin.MarshalBinary()
+		if !bytes.Equal(b1, b2) {
+			t.Errorf("%s: automatic compaction differs from Compact()", name)
+		}
+	}
+}
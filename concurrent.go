@@ -0,0 +1,247 @@
+package qthc
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// generations are unique per process, so trees that share nodes never
+// modify the same node.
+var lastGen atomic.Uint64
+
+// ConcurrentQuadTree is a QuadTree that can be used from several goroutines.
+//
+// Readers work on an immutable snapshot of the tree and never block. Writers
+// are serialized. Each write copies the nodes on the path it modifies
+// (copy-on-write) and then publishes the new root atomically, so a reader,
+// including a running iterator, only ever sees the state before or after a
+// write.
+type ConcurrentQuadTree[V any] struct {
+	mu   sync.Mutex
+	tree atomic.Pointer[QuadTree[V]]
+}
+
+// NewConcurrent creates an empty tree, see New().
+func NewConcurrent[V any](dim int, opts ...Option) *ConcurrentQuadTree[V] {
+	ans := new(ConcurrentQuadTree[V])
+	ans.tree.Store(New[V](dim, opts...))
+	return ans
+}
+
+func NewConcurrentQuadTree[V any](dim, maxNodeSize int) *ConcurrentQuadTree[V] {
+	ans := new(ConcurrentQuadTree[V])
+	ans.tree.Store(NewQuadTree[V](dim, maxNodeSize))
+	return ans
+}
+
+func NewDefaultConcurrentQuadTree[V any](dim int) *ConcurrentQuadTree[V] {
+	ans := new(ConcurrentQuadTree[V])
+	ans.tree.Store(NewDefaultQuadTree[V](dim))
+	return ans
+}
+
+func NewConcurrentQuadTreeWithBounds[V any](min, max []float64, maxNodeSize int, oob OutOfBoundsPolicy) *ConcurrentQuadTree[V] {
+	ans := new(ConcurrentQuadTree[V])
+	ans.tree.Store(NewQuadTreeWithBounds[V](min, max, maxNodeSize, oob))
+	return ans
+}
+
+func NewConcurrentQuadTreeWithPolicy[V any](dim, maxNodeSize int, policy DuplicatePolicy) *ConcurrentQuadTree[V] {
+	ans := new(ConcurrentQuadTree[V])
+	ans.tree.Store(NewQuadTreeWithPolicy[V](dim, maxNodeSize, policy))
+	return ans
+}
+
+// Snapshot returns the current state of the tree. The snapshot is not
+// affected by later writes. It may be modified, for example to try out
+// changes, without affecting the concurrent tree or other snapshots, but
+// like any QuadTree it must then not be used by several goroutines.
+func (c *ConcurrentQuadTree[V]) Snapshot() *QuadTree[V] {
+	return c.tree.Load().cowCopy()
+}
+
+// write applies a modification to a copy-on-write copy of the current tree
+// and publishes the result, unless the modification fails.
+func (c *ConcurrentQuadTree[V]) write(f func(t *QuadTree[V]) error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := c.tree.Load().cowCopy()
+	if err := f(t); err != nil {
+		return err
+	}
+	c.tree.Store(t)
+	return nil
+}
+
+// Insert works like QuadTree.Insert() but doesn't return a handle, entries
+// of a concurrent tree are copied when they change.
+func (c *ConcurrentQuadTree[V]) Insert(key []float64, value V) error {
+	return c.write(func(t *QuadTree[V]) error {
+		_, err := t.Insert(key, value)
+		return err
+	})
+}
+
+func (c *ConcurrentQuadTree[V]) Remove(key []float64) (V, bool, error) {
+	var ret V
+	var ok bool
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cur := c.tree.Load()
+	if err := cur.checkKey(key); err != nil {
+		return ret, false, err
+	}
+	if !cur.Contains(key) {
+		//avoid copying the path if there is nothing to remove
+		return ret, false, nil
+	}
+	t := cur.cowCopy()
+	ret, ok, _ = t.Remove(key)
+	c.tree.Store(t)
+	return ret, ok, nil
+}
+
+func (c *ConcurrentQuadTree[V]) Update(oldKey, newKey []float64) (V, bool, error) {
+	var ret V
+	var ok bool
+	var err error
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cur := c.tree.Load()
+	if err = cur.checkKey(oldKey); err != nil {
+		return ret, false, err
+	}
+	if !cur.Contains(oldKey) {
+		return ret, false, nil
+	}
+	t := cur.cowCopy()
+	ret, ok, err = t.Update(oldKey, newKey)
+	if err == nil {
+		c.tree.Store(t)
+	}
+	return ret, ok, err
+}
+
+func (c *ConcurrentQuadTree[V]) Put(key []float64, value V) (V, bool, error) {
+	var ret V
+	var ok bool
+	err := c.write(func(t *QuadTree[V]) error {
+		var err error
+		ret, ok, err = t.Put(key, value)
+		return err
+	})
+	return ret, ok, err
+}
+
+func (c *ConcurrentQuadTree[V]) PutIfAbsent(key []float64, value V) (V, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cur := c.tree.Load()
+	if old, ok, err := cur.Get(key); ok || err != nil {
+		return old, ok, err
+	}
+	t := cur.cowCopy()
+	if _, err := t.insert(key, value); err != nil {
+		var zero V
+		return zero, false, err
+	}
+	c.tree.Store(t)
+	return value, false, nil
+}
+
+// Compute works like QuadTree.Compute(). fn is called while holding the
+// write lock, it must not access c.
+func (c *ConcurrentQuadTree[V]) Compute(key []float64, fn func(old V, exists bool) (value V, keep bool)) (V, bool, error) {
+	var ret V
+	var ok bool
+	err := c.write(func(t *QuadTree[V]) error {
+		var err error
+		ret, ok, err = t.Compute(key, fn)
+		return err
+	})
+	return ret, ok, err
+}
+
+func (c *ConcurrentQuadTree[V]) RemoveValue(key []float64, value V) (bool, error) {
+	var ok bool
+	err := c.write(func(t *QuadTree[V]) error {
+		var err error
+		ok, err = t.RemoveValue(key, value)
+		return err
+	})
+	return ok, err
+}
+
+func (c *ConcurrentQuadTree[V]) RemoveRange(min, max []float64) int {
+	return c.RemoveIf(min, max, nil)
+}
+
+// RemoveIf works like QuadTree.RemoveIf(). pred is called while holding the
+// write lock, it must not access c.
+func (c *ConcurrentQuadTree[V]) RemoveIf(min, max []float64, pred func(e *Entry[V]) bool) int {
+	n := 0
+	c.write(func(t *QuadTree[V]) error {
+		n = t.RemoveIf(min, max, pred)
+		return nil
+	})
+	return n
+}
+
+func (c *ConcurrentQuadTree[V]) Compact() {
+	c.write(func(t *QuadTree[V]) error {
+		t.Compact()
+		return nil
+	})
+}
+
+func (c *ConcurrentQuadTree[V]) SetAutoCompact(fraction float64) {
+	c.write(func(t *QuadTree[V]) error {
+		t.SetAutoCompact(fraction)
+		return nil
+	})
+}
+
+func (c *ConcurrentQuadTree[V]) Clear() {
+	c.write(func(t *QuadTree[V]) error {
+		t.Clear()
+		return nil
+	})
+}
+
+func (c *ConcurrentQuadTree[V]) Size() int {
+	return c.tree.Load().Size()
+}
+
+func (c *ConcurrentQuadTree[V]) Contains(key []float64) bool {
+	return c.tree.Load().Contains(key)
+}
+
+func (c *ConcurrentQuadTree[V]) Get(key []float64) (V, bool, error) {
+	return c.tree.Load().Get(key)
+}
+
+func (c *ConcurrentQuadTree[V]) GetAll(key []float64) ([]V, error) {
+	return c.tree.Load().GetAll(key)
+}
+
+func (c *ConcurrentQuadTree[V]) Count(min, max []float64) int {
+	return c.tree.Load().Count(min, max)
+}
+
+// SearchIntersect returns an iterator over the snapshot at the time of the
+// call. Reset() restarts the query on that same snapshot.
+func (c *ConcurrentQuadTree[V]) SearchIntersect(min, max []float64) QueryIterator[V] {
+	return c.tree.Load().SearchIntersect(min, max)
+}
+
+func (c *ConcurrentQuadTree[V]) SearchRadius(center []float64, radius float64, m Metric) RadiusIterator[V] {
+	return c.tree.Load().SearchRadius(center, radius, m)
+}
+
+func (c *ConcurrentQuadTree[V]) SearchNearest(center []float64, m Metric) NearestIterator[V] {
+	return c.tree.Load().SearchNearest(center, m)
+}
+
+func (c *ConcurrentQuadTree[V]) NearestNeighbor(center []float64, k int, m Metric) []*EntryDist[V] {
+	return c.tree.Load().NearestNeighbor(center, k, m)
+}
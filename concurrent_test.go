@@ -0,0 +1,104 @@
+package qthc
+
+import (
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+// contents maps the values of a tree, which are unique, to their keys.
+func contents(qt *QuadTree[int]) map[int][2]float64 {
+	ans := make(map[int][2]float64)
+	for k, v := range qt.All() {
+		ans[v] = [2]float64{k[0], k[1]}
+	}
+	return ans
+}
+
+func TestConcurrentSnapshotsDuringWrites(t *testing.T) {
+	c := NewConcurrentQuadTree[int](2, 4)
+	for i := 0; i < 500; i++ {
+		c.Insert([]float64{float64(i%25) / 25, float64(i/25) / 25}, i)
+	}
+
+	const writers, readers, writes = 4, 4, 500
+	var wg, rg sync.WaitGroup
+	done := make(chan struct{})
+	errs := make(chan string, readers)
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			r := rand.New(rand.NewSource(int64(w)))
+			var keys [][]float64
+			for i := 0; i < writes; i++ {
+				switch op := r.Intn(4); {
+				case op < 2 || len(keys) == 0:
+					key := []float64{r.Float64(), r.Float64()}
+					c.Insert(key, (w+1)*writes+i)
+					keys = append(keys, key)
+				case op < 3:
+					j := r.Intn(len(keys))
+					c.Remove(keys[j])
+					keys = append(keys[:j], keys[j+1:]...)
+				default:
+					j := r.Intn(len(keys))
+					key := []float64{r.Float64(), r.Float64()}
+					c.Update(keys[j], key)
+					keys[j] = key
+				}
+			}
+		}(w)
+	}
+	for i := 0; i < readers; i++ {
+		rg.Add(1)
+		go func() {
+			defer rg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				s := c.Snapshot()
+				size := s.Size()
+				want := contents(s)
+				if len(want) != size {
+					errs <- "snapshot has a different number of entries than its size"
+					return
+				}
+				if n := s.Count([]float64{0, 0}, []float64{1, 1}); n != size {
+					errs <- "count of a snapshot differs from its size"
+					return
+				}
+				//writes continue, the snapshot must not change
+				got := contents(s)
+				if s.Size() != size || len(got) != len(want) {
+					errs <- "size of a snapshot changed"
+					return
+				}
+				for v, k := range want {
+					if got[v] != k {
+						errs <- "contents of a snapshot changed"
+						return
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(done)
+	rg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	s := c.Snapshot()
+	if err := s.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if s.Size() != c.Size() || len(contents(s)) != s.Size() {
+		t.Fatalf("size is %d, %d entries are reachable", s.Size(), len(contents(s)))
+	}
+}
@@ -1,54 +1,77 @@
 package qthc
 
-type Entry struct {
+type Entry[V any] struct {
 	point []float64
-	value interface{}
+	value V
+	//node that holds the entry, see Node.adopt()
+	node *Node[V]
 }
 
-func NewEntry(key []float64, value interface{}) *Entry {
-	ans := new(Entry)
+// NewEntry creates an entry that uses key as its point, without copying it.
+func NewEntry[V any](key []float64, value V) *Entry[V] {
+	ans := new(Entry[V])
 	ans.point = key
 	ans.value = value
 
 	return ans
 }
 
-func (e *Entry) Point() []float64 {
-	return e.point
+// Point returns a copy of the point of the entry. Coord() and AppendPoint()
+// read the point without allocating.
+func (e *Entry[V]) Point() []float64 {
+	return append([]float64(nil), e.point...)
 }
 
-func (e *Entry) Value() interface{} {
+// Coord returns coordinate d of the point of the entry.
+func (e *Entry[V]) Coord(d int) float64 {
+	return e.point[d]
+}
+
+// AppendPoint appends the point of the entry to dst.
+func (e *Entry[V]) AppendPoint(dst []float64) []float64 {
+	return append(dst, e.point...)
+}
+
+func (e *Entry[V]) Value() V {
 	return e.value
 }
 
-func (e *Entry) enclosed(min, max []float64) bool {
+func (e *Entry[V]) enclosed(min, max []float64) bool {
 	return isPointEnclosed(e.point, min, max)
 }
 
-func (e *Entry) enclosedFromCenter(center []float64, radius float64) bool {
+func (e *Entry[V]) enclosedFromCenter(center []float64, radius float64) bool {
 	return isPointEnclosedFromCenter(e.point, center, radius)
 }
 
-func (e *Entry) equals(ent *Entry) bool {
+func (e *Entry[V]) equals(ent *Entry[V]) bool {
 	return isPointEqual(e.point, ent.point)
 }
 
-type EntryDist struct {
-	Entry
-	dist float64
+// EntryDist is a copy of an entry and its distance to a query point. Handle()
+// returns the entry itself.
+type EntryDist[V any] struct {
+	Entry[V]
+	dist   float64
+	handle *Entry[V]
 }
 
-func NewEntryDist(e *Entry, distance float64) *EntryDist {
-	ans := new(EntryDist)
+func NewEntryDist[V any](e *Entry[V], distance float64) *EntryDist[V] {
+	ans := new(EntryDist[V])
 	ans.point = e.point
 	ans.value = e.value
 	ans.dist = distance
+	ans.handle = e
 
 	return ans
 }
 
-type byDistEntry []*EntryDist
+func (e *EntryDist[V]) Dist() float64 {
+	return e.dist
+}
 
-func (a byDistEntry) Len() int           { return len(a) }
-func (a byDistEntry) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
-func (a byDistEntry) Less(i, j int) bool { return a[i].dist < a[j].dist }
+// Handle returns the entry of the tree that e was copied from, which can be
+// passed to RemoveEntry() and MoveEntry().
+func (e *EntryDist[V]) Handle() *Entry[V] {
+	return e.handle
+}
@@ -3,11 +3,13 @@ package main
 import (
 	"fmt"
 	"github.com/jtejido/qthc"
+	"log/slog"
+	"os"
 )
 
 func main() {
-	qthc.DEBUG = true
-	qt := qthc.NewDefaultQuadTree(2)
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	qt := qthc.New[string](2, qthc.WithLogger(logger.With("tree", "things")))
 
 	things := [][]float64{
 		[]float64{0, 0},
@@ -22,8 +24,8 @@ func main() {
 		[]float64{3, 8},
 	}
 
-	for _, thing := range things {
-		qt.Insert(thing, nil)
+	for i, thing := range things {
+		qt.Insert(thing, fmt.Sprintf("thing %d", i))
 	}
 
 	q := qt.SearchIntersect([]float64{2, 1}, []float64{12, 7})
@@ -33,12 +35,15 @@ func main() {
 		fmt.Printf("%v : %v \n", i.Point(), i.Value())
 	}
 
-	// the data is interface{} type
-	// [3 1] : <nil>
-	// [2 6] : <nil>
-	// [3 6] : <nil>
-	// [10 3] : <nil>
-	// [8 6] : <nil>
-	// [11 7] : <nil>
+	// the data is of the tree's value type, string
+	// [3 1] : thing 1
+	// [2 6] : thing 6
+	// [3 6] : thing 7
+	// [10 3] : thing 4
+	// [8 6] : thing 3
+	// [11 7] : thing 5
 
+	if v, ok, _ := qt.Get([]float64{8, 6}); ok {
+		fmt.Println(v)
+	}
 }
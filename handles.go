@@ -0,0 +1,154 @@
+package qthc
+
+// RemoveEntry removes the entry e, which may be a handle returned by Insert(),
+// an entry returned by a query or EntryDist.Handle(), and returns whether e
+// was in the tree. The embedded Entry of an EntryDist is a copy and never in
+// the tree.
+// Unlike Remove() it doesn't search for the key, the entry knows its node.
+// If several entries share the key of e, exactly e is removed.
+//
+// Trees that share nodes with snapshots, see ConcurrentQuadTree, don't track
+// the nodes of entries and search for e from the root.
+func (qt *QuadTree[V]) RemoveEntry(e *Entry[V]) bool {
+	if qt.root == nil || e == nil || len(e.point) != qt.dim {
+		return false
+	}
+	if qt.gen != 0 {
+		qt.mutableRoot()
+		match := func(e2 *Entry[V]) bool { return e2 == e }
+		if qt.root.remove(nil, e.point, match, qt.maxNodeSize, qt.nodeEvents()) == nil {
+			return false
+		}
+	} else {
+		n := qt.owner(e)
+		if n == nil {
+			return false
+		}
+		n.detach(e, qt.maxNodeSize, qt.nodeEvents())
+	}
+	qt.size--
+	qt.afterRemove(1)
+	return true
+}
+
+// MoveEntry changes the point of the entry e to newKey and returns whether
+// e was in the tree, see RemoveEntry(). e remains a handle for the entry. If
+// newKey is still inside the node of e, no other node is visited. In map
+// mode an entry that already exists at newKey is removed. MoveEntry fails
+// like Update() if newKey is invalid or rejected, e then keeps its point.
+//
+// Trees that share nodes with snapshots remove e and insert a new entry, e
+// is then no longer a handle for it.
+func (qt *QuadTree[V]) MoveEntry(e *Entry[V], newKey []float64) (bool, error) {
+	if e == nil || len(e.point) != qt.dim {
+		return false, nil
+	}
+	if err := qt.checkKey(newKey); err != nil {
+		return false, err
+	}
+	if err := qt.checkBounds(newKey); err != nil {
+		return false, err
+	}
+	if qt.gen != 0 {
+		if !qt.RemoveEntry(e) {
+			return false, nil
+		}
+		_, err := qt.Insert(newKey, e.value)
+		return true, err
+	}
+	n := qt.owner(e)
+	if n == nil {
+		return false, nil
+	}
+	if qt.policy == Map && !isPointEqual(e.point, newKey) {
+		if old := qt.root.getExact(newKey); old != nil {
+			//may merge or compact nodes
+			qt.RemoveEntry(old)
+			n = qt.owner(e)
+		}
+	}
+
+	storeKey := qt.keys == CopyKeys
+	enclosed := isPointEnclosedFromCenter(newKey, n.center, n.radius/EPS_MUL)
+	switch {
+	case enclosed && n.isLeaf:
+		if storeKey {
+			newKey = n.storeKey(newKey, qt.maxNodeSize)
+		}
+		e.point = newKey
+		n.markDirty()
+	case enclosed:
+		var buf [hcInlineWords]uint64
+		n.removeSubEntry(n.calcSubPosition(e.point, buf[:]))
+		e.point = newKey
+		qt.putFrom(n, qt.depthOf(n), e, storeKey)
+		n.markDirty()
+	default:
+		n.detach(e, qt.maxNodeSize, qt.nodeEvents())
+		e.point = newKey
+		qt.ensureCoverage(e)
+		qt.put(e, storeKey)
+	}
+	qt.afterRemove(1)
+	return true, nil
+}
+
+// owner returns the node that holds e, or nil if e is not an entry of the
+// tree. Only trees that don't share nodes track the nodes of entries.
+func (qt *QuadTree[V]) owner(e *Entry[V]) *Node[V] {
+	n := e.node
+	if n == nil || qt.gen != 0 || !n.holds(e) {
+		return nil
+	}
+	//the node may belong to another tree or to a previous root
+	r := n
+	for r.parent != nil {
+		r = r.parent
+	}
+	if r != qt.root {
+		return nil
+	}
+	return n
+}
+
+// holds returns whether e is stored directly in n.
+func (n *Node[V]) holds(e *Entry[V]) bool {
+	if !n.isLeaf {
+		var buf [hcInlineWords]uint64
+		return n.getSub(n.calcSubPosition(e.point, buf[:])).entry == e
+	}
+	for i := 0; i < n.nValues; i++ {
+		if n.values[i] == e {
+			return true
+		}
+	}
+	return false
+}
+
+// markDirty marks n and its parents as changed, see QuadTree.owner().
+func (n *Node[V]) markDirty() {
+	for p := n; p != nil; p = p.parent {
+		p.dirty = true
+	}
+}
+
+// detach removes e from n, which must hold e, and merges n into its parent
+// if possible, like remove() does.
+func (n *Node[V]) detach(e *Entry[V], maxNodeSize int, ev nodeEvent[V]) {
+	if n.isLeaf {
+		for i := 0; i < n.nValues; i++ {
+			if n.values[i] == e {
+				n.removeValue(i)
+				break
+			}
+		}
+	} else {
+		var buf [hcInlineWords]uint64
+		n.removeSubEntry(n.calcSubPosition(e.point, buf[:]))
+	}
+	for p := n.parent; p != nil; p = p.parent {
+		p.nEntries--
+		p.dirty = true
+	}
+	n.removeSub(n.parent, maxNodeSize, ev)
+}
@@ -0,0 +1,42 @@
+package qthc
+
+import "testing"
+
+func TestNilEntryHandle(t *testing.T) {
+	qt := NewQuadTree[int](2, 4)
+	qt.Insert([]float64{1, 1}, 1)
+	if qt.RemoveEntry(nil) {
+		t.Fatal("RemoveEntry(nil) returned true")
+	}
+	if ok, err := qt.MoveEntry(nil, []float64{2, 2}); ok || err != nil {
+		t.Fatalf("MoveEntry(nil) returned %v, %v", ok, err)
+	}
+	if ok, _ := qt.MoveEntry(NewEntry([]float64{1}, 1), []float64{2, 2}); ok {
+		t.Fatal("MoveEntry moved an entry with the wrong dimensionality")
+	}
+}
+
+func TestDistanceResultHandles(t *testing.T) {
+	qt := NewQuadTree[int](2, 2)
+	for i := 0; i < 50; i++ {
+		qt.Insert([]float64{float64(i % 7), float64(i / 7)}, i)
+	}
+	nn := qt.NearestNeighbor([]float64{3, 3}, 2, nil)
+	if !qt.RemoveEntry(nn[0].Handle()) {
+		t.Fatal("result of NearestNeighbor is not a handle")
+	}
+	if qt.RemoveEntry(&nn[1].Entry) {
+		t.Fatal("removed the copy of an entry")
+	}
+	it := qt.SearchNearest([]float64{3, 3}, nil)
+	e := it.Next()
+	if ok, err := qt.MoveEntry(e.Handle(), []float64{20, 20}); !ok || err != nil {
+		t.Fatalf("MoveEntry returned %v, %v", ok, err)
+	}
+	if qt.Size() != 49 || !qt.Contains([]float64{20, 20}) || qt.Contains(e.point) {
+		t.Fatal("tree doesn't reflect the removal and the move")
+	}
+	if err := qt.Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,96 @@
+package qthc
+
+import (
+	"math/bits"
+)
+
+// hcPos is the address of a quadrant in the hypercube of a node. Every
+// dimension contributes one bit, dimension 0 being the most significant one.
+// The address is stored in big-endian word order, the first word holds the
+// most significant bits. Trees with up to 64 dimensions use a single word
+// whose value is the same as the classic integer address.
+type hcPos []uint64
+
+const (
+	// number of words that fit into stack allocated position buffers,
+	// i.e. up to 128 dimensions can be navigated without allocation.
+	hcInlineWords = 2
+)
+
+func hcWords(dim int) int {
+	return (dim + 63) >> 6
+}
+
+// hcBit returns the word and the bit mask that represent dimension d.
+func hcBit(dim, d int) (int, uint64) {
+	b := dim - 1 - d
+	return hcWords(dim) - 1 - b>>6, 1 << uint(b&63)
+}
+
+// hcMake returns an empty address, using buf if it is large enough.
+func hcMake(dim int, buf []uint64) hcPos {
+	w := hcWords(dim)
+	if cap(buf) < w {
+		return make(hcPos, w)
+	}
+	pos := hcPos(buf[:w])
+	for i := range pos {
+		pos[i] = 0
+	}
+	return pos
+}
+
+func (p hcPos) set(dim, d int) {
+	w, m := hcBit(dim, d)
+	p[w] |= m
+}
+
+func (p hcPos) isSet(dim, d int) bool {
+	w, m := hcBit(dim, d)
+	return p[w]&m != 0
+}
+
+func (p hcPos) compare(p2 hcPos) int {
+	for i := 0; i < len(p); i++ {
+		if p[i] != p2[i] {
+			if p[i] < p2[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// isValid checks whether p lies in the range of quadrants defined by the
+// masks m0 and m1, see StackEntry.set.
+func (p hcPos) isValid(m0, m1 hcPos) bool {
+	for i := 0; i < len(p); i++ {
+		if p[i]&m0[i] != m0[i] || p[i]|m1[i] != m1[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// inc sets p to the next valid quadrant with respect to the masks m0 and m1.
+// It returns false if there is no such quadrant.
+func (p hcPos) inc(m0, m1 hcPos) bool {
+	//first, fill all 'invalid' bits with '1' (bits that can have only one value).
+	//increment. The '1's in the invalid bits will cause bitwise overflow to the next valid bit.
+	carry := uint64(1)
+	overflow := true
+	for i := len(p) - 1; i >= 0; i-- {
+		r, c := bits.Add64(p[i]|^m1[i], 0, carry)
+		carry = c
+		//remove invalid bits.
+		np := (r & m1[i]) | m0[i]
+		if np != p[i] {
+			//bits that change in a more significant word decide whether we
+			//moved forward or overflowed
+			overflow = np < p[i]
+		}
+		p[i] = np
+	}
+	return !overflow
+}
@@ -0,0 +1,93 @@
+package qthc
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestHcPosIncMultiWord(t *testing.T) {
+	const dim = 70
+	m0, m1 := make(hcPos, hcWords(dim)), make(hcPos, hcWords(dim))
+	//dimension 3 is always set, 0, 5, 60 and 69 are free and span both words
+	for _, d := range []int{3, 0, 5, 60, 69} {
+		m1.set(dim, d)
+	}
+	m0.set(dim, 3)
+	p := append(hcPos(nil), m0...)
+	n := 1
+	for prev := append(hcPos(nil), p...); p.inc(m0, m1); n++ {
+		if !p.isValid(m0, m1) || p.compare(prev) <= 0 {
+			t.Fatalf("%x follows %x", p, prev)
+		}
+		copy(prev, p)
+	}
+	if n != 16 {
+		t.Fatalf("visited %d positions, want 16", n)
+	}
+}
+
+func TestHighDimensions(t *testing.T) {
+	r := rand.New(rand.NewSource(6))
+	//dense and sparse nodes around maxDenseDim, one and several words
+	for _, dim := range []int{maxDenseDim - 1, maxDenseDim, maxDenseDim + 1, 63, 64, 65, 128} {
+		qt := NewQuadTree[int](dim, 4)
+		var pts [][]float64
+		for i := 0; i < 1000; i++ {
+			//coarse coordinates fill many quadrants of the same nodes
+			p := gridPoint(r, dim, 4)
+			if i%2 == 0 {
+				p = randomPoint(r, dim)
+			}
+			pts = append(pts, p)
+			qt.Insert(p, i)
+		}
+		check := func() {
+			t.Helper()
+			if err := qt.Validate(); err != nil {
+				t.Fatalf("%d dimensions: %v", dim, err)
+			}
+			if qt.Size() != len(pts) {
+				t.Fatalf("%d dimensions: size %d, want %d", dim, qt.Size(), len(pts))
+			}
+			for q := 0; q < 10; q++ {
+				//restrict a few dimensions, the others are open
+				min, max := make([]float64, dim), make([]float64, dim)
+				for d := range min {
+					min[d], max[d] = math.Inf(-1), math.Inf(1)
+				}
+				for i := 0; i < 3; i++ {
+					d := r.Intn(dim)
+					min[d] = r.Float64() * 2
+					max[d] = min[d] + r.Float64()*2
+				}
+				want := 0
+				for _, p := range pts {
+					if isPointEnclosed(p, min, max) {
+						want++
+					}
+				}
+				got := 0
+				for it := qt.SearchIntersect(min, max); it.HasNext(); got++ {
+					if e := it.Next(); !e.enclosed(min, max) {
+						t.Fatalf("%d dimensions: %v is outside the window", dim, e.point)
+					}
+				}
+				if got != want {
+					t.Fatalf("%d dimensions: window has %d entries, want %d", dim, got, want)
+				}
+				c := randomPoint(r, dim)
+				checkNearest(t, qt.NearestNeighbor(c, 5, nil), bruteNearest(pts, c, 5, Euclidean{}))
+			}
+		}
+		check()
+		for i := 0; i < 700; i++ {
+			j := r.Intn(len(pts))
+			if _, ok, _ := qt.Remove(pts[j]); !ok {
+				t.Fatalf("%d dimensions: %v not found", dim, pts[j])
+			}
+			pts = append(pts[:j], pts[j+1:]...)
+		}
+		check()
+	}
+}
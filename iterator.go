@@ -1,30 +1,31 @@
 package qthc
 
-import (
-	"math"
-)
-
-type iterator struct {
-	tree     *QuadTree
-	stack    *IteratorStack
-	next     *Entry
+type iterator[V any] struct {
+	tree     *QuadTree[V]
+	stack    *IteratorStack[V]
+	next     *Entry[V]
 	min, max []float64
+	err      error
+	//optional hypersphere filter, used by radius queries
+	metric Metric
+	center []float64
+	radius float64
 }
 
-func newIterator(tree *QuadTree, min, max []float64) *iterator {
-	ans := new(iterator)
-	ans.stack = newIteratorStack()
+func newIterator[V any](tree *QuadTree[V], min, max []float64) *iterator[V] {
+	ans := new(iterator[V])
+	ans.stack = newIteratorStack[V]()
 	ans.tree = tree
 	ans.Reset(min, max)
 
 	return ans
 }
 
-func (it *iterator) HasNext() bool {
+func (it *iterator[V]) HasNext() bool {
 	return it.next != nil
 }
 
-func (it *iterator) Next() *Entry {
+func (it *iterator[V]) Next() *Entry[V] {
 	ret := it.next
 	it.findNext()
 	return ret
@@ -34,49 +35,40 @@ func (it *iterator) Next() *Entry {
  * Reset the iterator. This iterator can be reused in order to reduce load on the
  * garbage collector.
  */
-func (it *iterator) Reset(min, max []float64) {
+func (it *iterator[V]) Reset(min, max []float64) {
 	it.stack.clear()
 	it.min = min
 	it.max = max
 	it.next = nil
-	if it.tree.root != nil {
+	it.err = it.tree.checkWindow(min, max)
+	if it.err != nil {
+		return
+	}
+	if it.tree.root != nil && it.acceptNode(it.tree.root) {
 		it.stack.prepareAndPush(it.tree.root, min, max)
 		it.findNext()
 	}
 }
 
-func (it *iterator) findNext() {
+func (it *iterator[V]) Err() error {
+	return it.err
+}
+
+func (it *iterator[V]) findNext() {
 	for !it.stack.isEmpty() {
 		se := it.stack.peek()
-		for se.pos < int64(se.len) {
-			if se.isLeaf {
-				e := se.entries[int(se.pos)].(*Entry)
-				se.pos++
-				if e.enclosed(it.min, it.max) {
-					it.next = e
-					return
-				}
-			} else {
-				pos := int(se.pos)
-				se.inc()
-				//abort in next round if no increment is detected
-				if se.pos <= int64(pos) {
-					se.pos = math.MaxInt64
-				}
-
-				e := se.entries[pos]
-				if e != nil {
-					if v, ok := e.(*Node); ok {
-						node := v
-						se = it.stack.prepareAndPush(node, it.min, it.max)
-					} else {
-						qe := e.(*Entry)
-						if qe.enclosed(it.min, it.max) {
-							it.next = qe
-							return
-						}
-					}
+		for {
+			c, ok := se.nextSlot()
+			if !ok {
+				break
+			}
+			if node := c.node; node != nil {
+				if it.acceptNode(node) {
+					se = it.stack.prepareAndPush(node, it.min, it.max)
 				}
+			} else if qe := c.entry; qe != nil && it.accept(qe) {
+				it.next = qe
+				return
 			}
 		}
 		it.stack.pop()
@@ -84,22 +76,33 @@ func (it *iterator) findNext() {
 	it.next = nil
 }
 
-type IteratorStack struct {
-	stack []*StackEntry
+func (it *iterator[V]) accept(e *Entry[V]) bool {
+	if !e.enclosed(it.min, it.max) {
+		return false
+	}
+	return it.metric == nil || it.metric.Distance(it.center, e.point) <= it.radius
+}
+
+func (it *iterator[V]) acceptNode(node *Node[V]) bool {
+	return it.metric == nil || it.metric.DistToNode(it.center, node.center, node.radius) <= it.radius
+}
+
+type IteratorStack[V any] struct {
+	stack []*StackEntry[V]
 	size  int
 }
 
-func newIteratorStack() *IteratorStack {
-	return &IteratorStack{make([]*StackEntry, 0), 0}
+func newIteratorStack[V any]() *IteratorStack[V] {
+	return &IteratorStack[V]{make([]*StackEntry[V], 0), 0}
 }
 
-func (it *IteratorStack) isEmpty() bool {
+func (it *IteratorStack[V]) isEmpty() bool {
 	return it.size == 0
 }
 
-func (it *IteratorStack) prepareAndPush(node *Node, min, max []float64) *StackEntry {
+func (it *IteratorStack[V]) prepareAndPush(node *Node[V], min, max []float64) *StackEntry[V] {
 	if it.size == len(it.stack) {
-		it.stack = append(it.stack, new(StackEntry))
+		it.stack = append(it.stack, new(StackEntry[V]))
 	}
 	ni := it.stack[it.size]
 	it.size++
@@ -108,62 +111,102 @@ func (it *IteratorStack) prepareAndPush(node *Node, min, max []float64) *StackEn
 	return ni
 }
 
-func (it *IteratorStack) peek() *StackEntry {
+func (it *IteratorStack[V]) peek() *StackEntry[V] {
 	return it.stack[it.size-1]
 }
 
-func (it *IteratorStack) pop() *StackEntry {
+func (it *IteratorStack[V]) pop() *StackEntry[V] {
 	it.size--
 	return it.stack[it.size]
 
 }
 
-func (it *IteratorStack) clear() {
+func (it *IteratorStack[V]) clear() {
 	it.size = 0
 }
 
-type StackEntry struct {
-	pos, m0, m1 int64
-	entries     []interface{}
+type StackEntry[V any] struct {
+	node        *Node[V]
+	pos, m0, m1 hcPos
 	isLeaf      bool
-	len         int
+	//position in leaf values or sparse subs
+	i, len int
+	done   bool
 }
 
-func (se *StackEntry) set(node *Node, min, max []float64) {
-	se.entries = node.entries()
+func (se *StackEntry[V]) set(node *Node[V], min, max []float64) {
+	se.node = node
 	se.isLeaf = node.isLeaf
+	se.i = 0
+	se.done = false
 
 	if se.isLeaf {
 		se.len = node.nValues
-		se.pos = 0
 	} else {
-		se.len = len(se.entries)
-		se.m0 = 0
-		se.m1 = 0
-		center := node.center
-		for d := 0; d < len(center); d++ {
-			se.m0 <<= 1
-			se.m1 <<= 1
-			if max[d] >= center[d] {
-				se.m1 |= 1
-				if min[d] >= center[d] {
-					se.m0 |= 1
-				}
+		dim := len(node.center)
+		se.m0, se.m1 = node.masks(min, max, se.m0, se.m1)
+		if node.subs != nil {
+			se.pos = hcMake(dim, se.pos)
+			copy(se.pos, se.m0)
+		} else {
+			//sparse nodes are scanned from the first quadrant >= m0
+			se.i, _ = node.findSparse(se.m0)
+			se.len = len(node.sparseSubs)
+		}
+	}
+}
+
+// masks returns the lower and upper hypercube positions of the quadrants of
+// n that may intersect with min/max, using buf0 and buf1 if possible.
+func (n *Node[V]) masks(min, max []float64, buf0, buf1 []uint64) (hcPos, hcPos) {
+	center := n.center
+	dim := len(center)
+	m0 := hcMake(dim, buf0)
+	m1 := hcMake(dim, buf1)
+	for d := 0; d < dim; d++ {
+		if max[d] >= center[d] {
+			m1.set(dim, d)
+			if min[d] >= center[d] {
+				m0.set(dim, d)
 			}
 		}
-		se.pos = se.m0
 	}
+	return m0, m1
 }
 
-func (se *StackEntry) inc() {
-	//first, fill all 'invalid' bits with '1' (bits that can have only one value).
-	r := se.pos | (^se.m1)
-	//increment. The '1's in the invalid bits will cause bitwise overflow to the next valid bit.
-	r++
-	//remove invalid bits.
-	se.pos = (r & se.m1) | se.m0
+// nextSlot returns the content of the next quadrant that may intersect with
+// the query box, an empty child if that quadrant is empty. The boolean is
+// false once the node is exhausted.
+func (se *StackEntry[V]) nextSlot() (child[V], bool) {
+	if se.isLeaf {
+		if se.i >= se.len {
+			return child[V]{}, false
+		}
+		se.i++
+		return entryChild(se.node.values[se.i-1]), true
+	}
 
-	//return -1 if we exceed 'max' and cause an overflow or return the original value. The
-	//latter can happen if there is only one possible value (all filter bits are set).
-	//return (r <= v) ? -1 : r;
+	node := se.node
+	if node.subs != nil {
+		if se.done {
+			return child[V]{}, false
+		}
+		e := node.subs[se.pos[0]]
+		//abort in next round if no increment is detected
+		se.done = !se.pos.inc(se.m0, se.m1)
+		return e, true
+	}
+
+	for se.i < se.len {
+		p := node.slotPos(se.i)
+		if p.compare(se.m1) > 0 {
+			break
+		}
+		se.i++
+		if p.isValid(se.m0, se.m1) {
+			return node.sparseSubs[se.i-1], true
+		}
+	}
+	se.i = se.len
+	return child[V]{}, false
 }
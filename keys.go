@@ -0,0 +1,56 @@
+package qthc
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// KeyPolicy defines who owns the key slices that are passed to a tree.
+type KeyPolicy int
+
+const (
+	// CopyKeys copies keys when they are stored, callers may reuse their
+	// slices. The copies of entries that are inserted into the same node
+	// share one coordinate array. This is the default.
+	CopyKeys KeyPolicy = iota
+	// BorrowKeys stores the slices that are passed in. Callers must not
+	// modify them afterwards, otherwise entries become unreachable.
+	BorrowKeys
+)
+
+var (
+	ErrDimensionMismatch   = errors.New("qthc: number of coordinates does not match the dimensionality")
+	ErrNonFiniteCoordinate = errors.New("qthc: coordinate is NaN or infinite")
+	ErrInvalidRange        = errors.New("qthc: invalid query range")
+)
+
+// checkKey returns an error if key can't be stored in the tree.
+func (qt *QuadTree[V]) checkKey(key []float64) error {
+	if len(key) != qt.dim {
+		return fmt.Errorf("%w: got %d, want %d", ErrDimensionMismatch, len(key), qt.dim)
+	}
+	for d, x := range key {
+		if math.IsNaN(x) || math.IsInf(x, 0) {
+			return fmt.Errorf("%w: %v in dimension %d", ErrNonFiniteCoordinate, x, d)
+		}
+	}
+	return nil
+}
+
+// checkWindow returns an error if min/max is not a valid query window.
+// Infinite coordinates are allowed, they describe open ranges.
+func (qt *QuadTree[V]) checkWindow(min, max []float64) error {
+	if len(min) != qt.dim || len(max) != qt.dim {
+		return fmt.Errorf("%w: got %d/%d, want %d", ErrDimensionMismatch, len(min), len(max), qt.dim)
+	}
+	for d := range min {
+		if math.IsNaN(min[d]) || math.IsNaN(max[d]) {
+			return fmt.Errorf("%w: NaN in dimension %d", ErrInvalidRange, d)
+		}
+		if min[d] > max[d] {
+			return fmt.Errorf("%w: min %v > max %v in dimension %d", ErrInvalidRange, min[d], max[d], d)
+		}
+	}
+	return nil
+}
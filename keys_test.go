@@ -0,0 +1,44 @@
+package qthc
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestInvalidQueryCenter(t *testing.T) {
+	qt := NewQuadTree[int](2, 4)
+	for i := 0; i < 20; i++ {
+		qt.Insert([]float64{float64(i), float64(i % 3)}, i)
+	}
+	for _, c := range []struct {
+		center []float64
+		err    error
+	}{
+		{[]float64{1}, ErrDimensionMismatch},
+		{[]float64{1, 2, 3}, ErrDimensionMismatch},
+		{[]float64{1, math.NaN()}, ErrNonFiniteCoordinate},
+	} {
+		r := qt.SearchRadius(c.center, 5, nil)
+		if r.HasNext() || !errors.Is(r.Err(), c.err) {
+			t.Errorf("SearchRadius(%v): error %v, want %v", c.center, r.Err(), c.err)
+		}
+		n := qt.SearchNearest(c.center, nil)
+		if n.HasNext() || !errors.Is(n.Err(), c.err) {
+			t.Errorf("SearchNearest(%v): error %v, want %v", c.center, n.Err(), c.err)
+		}
+		if res := qt.NearestNeighbor(c.center, 3, nil); len(res) != 0 {
+			t.Errorf("NearestNeighbor(%v) returned %d entries", c.center, len(res))
+		}
+
+		//a valid center clears the error
+		r.Reset([]float64{0, 0}, 5)
+		if r.Err() != nil || !r.HasNext() {
+			t.Errorf("SearchRadius after Reset: error %v", r.Err())
+		}
+		n.Reset([]float64{0, 0})
+		if n.Err() != nil || !n.HasNext() {
+			t.Errorf("SearchNearest after Reset: error %v", n.Err())
+		}
+	}
+}
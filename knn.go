@@ -0,0 +1,133 @@
+package qthc
+
+import (
+	"container/heap"
+	"math"
+	"sort"
+)
+
+// knnSearch performs a depth-first k-nearest-neighbor search. Subnodes are
+// visited in order of their distance to the query point, and the k best
+// entries found so far are kept in a bounded max-heap whose top defines the
+// current search radius.
+//
+// Entries with equal distance are ordered by comparing their points
+// lexicographically, so the result is fully defined even when ties occur at
+// the k-th position.
+type knnSearch[V any] struct {
+	center []float64
+	metric Metric
+	k      int
+	best   knnHeap[V]
+	//reused buffer of subnodes, used as a stack across recursion levels
+	buffer []knnCandidate[V]
+}
+
+type knnCandidate[V any] struct {
+	node *Node[V]
+	dist float64
+}
+
+func newKnnSearch[V any](center []float64, k int, m Metric) *knnSearch[V] {
+	ans := new(knnSearch[V])
+	ans.center = center
+	ans.metric = m
+	ans.k = k
+	if k < 64 {
+		ans.best = make(knnHeap[V], 0, k)
+	}
+	return ans
+}
+
+func (s *knnSearch[V]) maxRange() float64 {
+	if len(s.best) < s.k {
+		return math.Inf(1)
+	}
+	return s.best[0].dist
+}
+
+func (s *knnSearch[V]) search(node *Node[V]) {
+	if node.isLeaf {
+		for i := 0; i < node.nValues; i++ {
+			e := node.values[i]
+			s.offer(e, s.metric.Distance(s.center, e.point))
+		}
+		return
+	}
+
+	start := len(s.buffer)
+	for i := 0; i < node.numSlots(); i++ {
+		c := node.slot(i)
+		if v := c.node; v != nil {
+			dist := s.metric.DistToNode(s.center, v.center, v.radius)
+			if dist <= s.maxRange() {
+				s.buffer = append(s.buffer, knnCandidate[V]{v, dist})
+			}
+		} else if v := c.entry; v != nil {
+			s.offer(v, s.metric.Distance(s.center, v.point))
+		}
+	}
+
+	subs := s.buffer[start:]
+	sort.Sort(byDistKnn[V](subs))
+	for i := 0; i < len(subs); i++ {
+		//check again, because maxRange shrinks during this loop
+		if subs[i].dist > s.maxRange() {
+			break
+		}
+		s.search(subs[i].node)
+	}
+	s.buffer = s.buffer[:start]
+}
+
+func (s *knnSearch[V]) offer(e *Entry[V], dist float64) {
+	if len(s.best) < s.k {
+		heap.Push(&s.best, NewEntryDist(e, dist))
+		return
+	}
+	top := s.best[0]
+	if dist > top.dist || (dist == top.dist && comparePoints(e.point, top.point) >= 0) {
+		return
+	}
+	s.best[0] = NewEntryDist(e, dist)
+	heap.Fix(&s.best, 0)
+}
+
+// result drains the heap and returns the candidates sorted by increasing
+// distance.
+func (s *knnSearch[V]) result() []*EntryDist[V] {
+	ans := make([]*EntryDist[V], len(s.best))
+	for i := len(ans) - 1; i >= 0; i-- {
+		ans[i] = heap.Pop(&s.best).(*EntryDist[V])
+	}
+	return ans
+}
+
+// knnHeap is a max-heap, the worst candidate is on top.
+type knnHeap[V any] []*EntryDist[V]
+
+func (h knnHeap[V]) Len() int { return len(h) }
+func (h knnHeap[V]) Less(i, j int) bool {
+	if h[i].dist != h[j].dist {
+		return h[i].dist > h[j].dist
+	}
+	return comparePoints(h[i].point, h[j].point) > 0
+}
+func (h knnHeap[V]) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *knnHeap[V]) Push(x interface{}) {
+	*h = append(*h, x.(*EntryDist[V]))
+}
+func (h *knnHeap[V]) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return x
+}
+
+type byDistKnn[V any] []knnCandidate[V]
+
+func (a byDistKnn[V]) Len() int           { return len(a) }
+func (a byDistKnn[V]) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byDistKnn[V]) Less(i, j int) bool { return a[i].dist < a[j].dist }
@@ -0,0 +1,102 @@
+package qthc
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+// bruteNearest returns the k points closest to c, ordered like the result
+// of NearestNeighbor().
+func bruteNearest(pts [][]float64, c []float64, k int, m Metric) []*EntryDist[int] {
+	ans := make([]*EntryDist[int], len(pts))
+	for i, p := range pts {
+		ans[i] = NewEntryDist(NewEntry(p, i), m.Distance(c, p))
+	}
+	sort.Slice(ans, func(i, j int) bool {
+		if ans[i].Dist() != ans[j].Dist() {
+			return ans[i].Dist() < ans[j].Dist()
+		}
+		return comparePoints(ans[i].point, ans[j].point) < 0
+	})
+	return ans[:min(max(k, 0), len(ans))]
+}
+
+// checkNearest compares the distances and points of a k nearest neighbor
+// result with the expected one.
+func checkNearest(t *testing.T, got, want []*EntryDist[int]) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d entries, want %d", len(got), len(want))
+	}
+	for i := range got {
+		if got[i].Dist() != want[i].Dist() || !isPointEqual(got[i].point, want[i].point) {
+			t.Fatalf("entry %d is %v at %v, want %v at %v",
+				i, got[i].point, got[i].Dist(), want[i].point, want[i].Dist())
+		}
+	}
+}
+
+// gridPoint returns a point with integer coordinates, many of them have
+// the same distance to a query point.
+func gridPoint(r *rand.Rand, dim, n int) []float64 {
+	p := make([]float64, dim)
+	for d := range p {
+		p[d] = float64(r.Intn(n))
+	}
+	return p
+}
+
+func TestNearestNeighborMatchesBruteForce(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for _, dim := range []int{1, 2, 3, 5} {
+		qt := NewQuadTree[int](dim, 4)
+		var pts [][]float64
+		for i := 0; i < 1000; i++ {
+			p := gridPoint(r, dim, 20)
+			pts = append(pts, p)
+			qt.Insert(p, i)
+		}
+		for q := 0; q < 30; q++ {
+			//integer centers produce ties at the k-th position
+			c := gridPoint(r, dim, 30)
+			if q%2 == 0 {
+				c = randomPoint(r, dim)
+				for d := range c {
+					c[d] = c[d]*30 - 5
+				}
+			}
+			for _, k := range []int{1, 3, 10, 64, 100} {
+				checkNearest(t, qt.NearestNeighbor(c, k, nil), bruteNearest(pts, c, k, Euclidean{}))
+			}
+		}
+	}
+}
+
+func TestNearestNeighborK(t *testing.T) {
+	qt := NewQuadTree[int](2, 4)
+	var pts [][]float64
+	for i := 0; i < 10; i++ {
+		p := []float64{float64(i), float64(i % 3)}
+		pts = append(pts, p)
+		qt.Insert(p, i)
+	}
+	c := []float64{4, 1}
+	//all entries if k exceeds the size
+	checkNearest(t, qt.NearestNeighbor(c, 25, nil), bruteNearest(pts, c, 25, Euclidean{}))
+	for _, k := range []int{0, -1} {
+		if res := qt.NearestNeighbor(c, k, nil); res == nil || len(res) != 0 {
+			t.Fatalf("k = %d returned %v", k, res)
+		}
+	}
+	if res := NewQuadTree[int](2, 4).NearestNeighbor(c, 3, nil); res == nil || len(res) != 0 {
+		t.Fatalf("empty tree returned %v", res)
+	}
+	//(3, 0) and (5, 2) have the same distance, the lexicographically
+	//smaller point wins the second place
+	res := qt.NearestNeighbor(c, 2, nil)
+	checkNearest(t, res, bruteNearest(pts, c, 2, Euclidean{}))
+	if !isPointEqual(res[1].point, []float64{3, 0}) {
+		t.Fatalf("tie is resolved as %v", res[1].point)
+	}
+}
@@ -0,0 +1,39 @@
+package qthc
+
+import (
+	"context"
+	"log/slog"
+	"math"
+)
+
+// logs returns whether the tree logs events of the given level.
+func (qt *QuadTree[V]) logs(level slog.Level) bool {
+	return qt.logger != nil && qt.logger.Enabled(context.Background(), level)
+}
+
+func (qt *QuadTree[V]) log(level slog.Level, msg string, attrs ...slog.Attr) {
+	qt.logger.LogAttrs(context.Background(), level, msg, attrs...)
+}
+
+// nodeEvents returns the function that logs splits and merges, or nil if
+// they are not logged.
+func (qt *QuadTree[V]) nodeEvents() nodeEvent[V] {
+	if !qt.logs(slog.LevelDebug) {
+		return nil
+	}
+	return qt.logNode
+}
+
+func (qt *QuadTree[V]) logNode(msg string, n *Node[V]) {
+	qt.log(slog.LevelDebug, msg,
+		slog.Int("depth", qt.depthOf(n)),
+		slog.Any("center", n.center),
+		slog.Float64("radius", n.radius),
+		slog.Int("entries", n.nValues))
+}
+
+// depthOf returns the depth of n below the root. The radius is halved on
+// each level.
+func (qt *QuadTree[V]) depthOf(n *Node[V]) int {
+	return int(math.Round(math.Log2(qt.root.radius / n.radius)))
+}
@@ -0,0 +1,135 @@
+package qthc
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"testing"
+)
+
+// recordHandler collects the records of a logger, with the attributes of
+// the logger and the record formatted by fmt.Sprint().
+type recordHandler struct {
+	level   slog.Level
+	attrs   []slog.Attr
+	records *[]loggedEvent
+}
+
+type loggedEvent struct {
+	level slog.Level
+	msg   string
+	attrs map[string]string
+}
+
+func newRecordHandler(level slog.Level) *recordHandler {
+	h := new(recordHandler)
+	h.level = level
+	h.records = new([]loggedEvent)
+	return h
+}
+
+func (h *recordHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level
+}
+
+func (h *recordHandler) Handle(_ context.Context, r slog.Record) error {
+	ev := loggedEvent{r.Level, r.Message, make(map[string]string)}
+	add := func(a slog.Attr) bool {
+		ev.attrs[a.Key] = fmt.Sprint(a.Value.Any())
+		return true
+	}
+	for _, a := range h.attrs {
+		add(a)
+	}
+	r.Attrs(add)
+	*h.records = append(*h.records, ev)
+	return nil
+}
+
+func (h *recordHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	h2 := *h
+	h2.attrs = append(append([]slog.Attr(nil), h.attrs...), attrs...)
+	return &h2
+}
+
+func (h *recordHandler) WithGroup(string) slog.Handler {
+	return h
+}
+
+func TestLogEvents(t *testing.T) {
+	domain := WithBounds([]float64{0, 0}, []float64{8, 8}, Reject)
+	growing := WithBounds([]float64{0, 0}, []float64{8, 8}, Grow)
+	tests := []struct {
+		name  string
+		opts  []Option
+		level slog.Level
+		do    func(qt *QuadTree[int])
+		want  loggedEvent
+	}{
+		{"new tree", []Option{WithMaxNodeSize(3)}, slog.LevelDebug, func(qt *QuadTree[int]) {},
+			loggedEvent{slog.LevelDebug, "tree created", map[string]string{"dim": "2", "maxNodeSize": "3"}}},
+		{"split", []Option{domain, WithMaxNodeSize(2)}, slog.LevelDebug, func(qt *QuadTree[int]) {
+			qt.Insert([]float64{1, 1}, 1)
+			qt.Insert([]float64{2, 2}, 2)
+			qt.Insert([]float64{5, 5}, 3)
+		}, loggedEvent{slog.LevelDebug, "node split", map[string]string{"depth": "0", "center": "[4 4]", "radius": "4"}}},
+		{"merge", []Option{domain, WithMaxNodeSize(2)}, slog.LevelDebug, func(qt *QuadTree[int]) {
+			qt.Insert([]float64{1, 1}, 1)
+			qt.Insert([]float64{2, 2}, 2)
+			qt.Insert([]float64{5, 5}, 3)
+			qt.Remove([]float64{2, 2})
+		}, loggedEvent{slog.LevelDebug, "nodes merged", map[string]string{"depth": "0", "center": "[4 4]", "radius": "4", "entries": "2"}}},
+		{"root growth", []Option{growing}, slog.LevelDebug, func(qt *QuadTree[int]) {
+			qt.Insert([]float64{9, 1}, 1)
+		}, loggedEvent{slog.LevelDebug, "root grown", map[string]string{"key": "[9 1]", "center": "[8 8]", "radius": "8"}}},
+		{"out of bounds", []Option{growing}, slog.LevelDebug, func(qt *QuadTree[int]) {
+			qt.Insert([]float64{9, 1}, 1)
+		}, loggedEvent{slog.LevelDebug, "point out of bounds, growing", map[string]string{"key": "[9 1]"}}},
+		{"reinsert failure", []Option{growing}, slog.LevelDebug, func(qt *QuadTree[int]) {
+			qt.Insert([]float64{1, 1}, 1)
+			qt.Update([]float64{1, 1}, []float64{9, 1})
+		}, loggedEvent{slog.LevelDebug, "reinsert failure, key is outside of root", map[string]string{"key": "[9 1]", "center": "[4 4]", "radius": "4"}}},
+		{"remove failure", nil, slog.LevelDebug, func(qt *QuadTree[int]) {
+			qt.Insert([]float64{1, 1}, 1)
+			qt.Remove([]float64{2, 2})
+		}, loggedEvent{slog.LevelDebug, "remove failure, entry not found", map[string]string{"key": "[2 2]"}}},
+		{"update failure", nil, slog.LevelDebug, func(qt *QuadTree[int]) {
+			qt.Insert([]float64{1, 1}, 1)
+			qt.Update([]float64{2, 2}, []float64{3, 3})
+		}, loggedEvent{slog.LevelDebug, "update failure, entry not found", map[string]string{"key": "[2 2]"}}},
+		{"rejected", []Option{domain}, slog.LevelWarn, func(qt *QuadTree[int]) {
+			qt.Insert([]float64{9, 1}, 1)
+		}, loggedEvent{slog.LevelWarn, "point out of bounds, rejected", map[string]string{"key": "[9 1]"}}},
+	}
+	for _, test := range tests {
+		h := newRecordHandler(test.level)
+		opts := append([]Option{WithLogger(slog.New(h).With("tree", test.name))}, test.opts...)
+		qt := New[int](2, opts...)
+		test.do(qt)
+
+		found := false
+		for _, ev := range *h.records {
+			if ev.level < test.level {
+				t.Errorf("%s: %s is logged at level %v", test.name, ev.msg, ev.level)
+			}
+			if ev.msg != test.want.msg {
+				continue
+			}
+			found = true
+			if ev.level != test.want.level {
+				t.Errorf("%s: level is %v, want %v", test.name, ev.level, test.want.level)
+			}
+			if ev.attrs["tree"] != test.name {
+				t.Errorf("%s: the attributes of the logger are lost", test.name)
+			}
+			for k, v := range test.want.attrs {
+				if ev.attrs[k] != v {
+					t.Errorf("%s: %s is %q, want %q", test.name, k, ev.attrs[k], v)
+				}
+			}
+		}
+		if !found {
+			t.Errorf("%s: %q is not logged", test.name, test.want.msg)
+		}
+	}
+}
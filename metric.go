@@ -0,0 +1,201 @@
+package qthc
+
+import (
+	"math"
+)
+
+// Metric defines the distance used by nearest neighbor and radius queries.
+//
+// DistToNode must never be larger than the distance from point to any point
+// inside the node's box (center +/- radius in every dimension), otherwise
+// queries may miss entries.
+type Metric interface {
+	Distance(p1, p2 []float64) float64
+	DistToNode(point, nodeCenter []float64, nodeRadius float64) float64
+}
+
+// BoundedMetric is implemented by metrics that can compute the axis aligned
+// bounding box of all points within a distance of center. Radius queries use
+// it to restrict the hypercube navigation, for other metrics they rely on
+// DistToNode alone.
+type BoundedMetric interface {
+	Metric
+	Bounds(center []float64, radius float64, min, max []float64)
+}
+
+// Euclidean is the L2 metric. It is the default metric if none is given.
+type Euclidean struct{}
+
+func (Euclidean) Distance(p1, p2 []float64) float64 {
+	return distance(p1, p2)
+}
+
+func (Euclidean) Bounds(center []float64, radius float64, min, max []float64) {
+	boundsFromRadius(center, radius, min, max)
+}
+
+func (Euclidean) DistToNode(point, nodeCenter []float64, nodeRadius float64) float64 {
+	return distToRectNode(point, nodeCenter, nodeRadius)
+}
+
+// Manhattan is the L1 metric.
+type Manhattan struct{}
+
+func (Manhattan) Distance(p1, p2 []float64) float64 {
+	var dist float64
+	for i := 0; i < len(p1); i++ {
+		dist += math.Abs(p1[i] - p2[i])
+	}
+	return dist
+}
+
+func (Manhattan) Bounds(center []float64, radius float64, min, max []float64) {
+	boundsFromRadius(center, radius, min, max)
+}
+
+func (Manhattan) DistToNode(point, nodeCenter []float64, nodeRadius float64) float64 {
+	var dist float64
+	for i := 0; i < len(point); i++ {
+		dist += distToInterval(point[i], nodeCenter[i], nodeRadius)
+	}
+	return dist
+}
+
+// Chebyshev is the L-infinity metric.
+type Chebyshev struct{}
+
+func (Chebyshev) Distance(p1, p2 []float64) float64 {
+	var dist float64
+	for i := 0; i < len(p1); i++ {
+		dist = math.Max(dist, math.Abs(p1[i]-p2[i]))
+	}
+	return dist
+}
+
+func (Chebyshev) Bounds(center []float64, radius float64, min, max []float64) {
+	boundsFromRadius(center, radius, min, max)
+}
+
+func (Chebyshev) DistToNode(point, nodeCenter []float64, nodeRadius float64) float64 {
+	var dist float64
+	for i := 0; i < len(point); i++ {
+		dist = math.Max(dist, distToInterval(point[i], nodeCenter[i], nodeRadius))
+	}
+	return dist
+}
+
+// Lp is the Minkowski metric of order P, P must be finite and >= 1. The
+// limit for an infinite P is Chebyshev.
+type Lp struct {
+	P float64
+}
+
+func NewLp(p float64) Lp {
+	if p < 1 || math.IsNaN(p) || math.IsInf(p, 1) {
+		panic("qthc: Lp metric requires a finite p >= 1, use Chebyshev for p = +Inf")
+	}
+	return Lp{p}
+}
+
+func (m Lp) Distance(p1, p2 []float64) float64 {
+	var dist float64
+	for i := 0; i < len(p1); i++ {
+		dist += math.Pow(math.Abs(p1[i]-p2[i]), m.P)
+	}
+	return math.Pow(dist, 1/m.P)
+}
+
+func (m Lp) Bounds(center []float64, radius float64, min, max []float64) {
+	boundsFromRadius(center, radius, min, max)
+}
+
+func (m Lp) DistToNode(point, nodeCenter []float64, nodeRadius float64) float64 {
+	var dist float64
+	for i := 0; i < len(point); i++ {
+		dist += math.Pow(distToInterval(point[i], nodeCenter[i], nodeRadius), m.P)
+	}
+	return math.Pow(dist, 1/m.P)
+}
+
+// WeightedEuclidean is the Euclidean metric with a non-negative weight per
+// dimension: sqrt(sum(w[i] * (p1[i]-p2[i])^2)).
+type WeightedEuclidean struct {
+	Weights []float64
+}
+
+func NewWeightedEuclidean(weights []float64) WeightedEuclidean {
+	for _, w := range weights {
+		if w < 0 || math.IsNaN(w) || math.IsInf(w, 0) {
+			panic("qthc: weights must be finite and non-negative")
+		}
+	}
+	return WeightedEuclidean{weights}
+}
+
+func (m WeightedEuclidean) Distance(p1, p2 []float64) float64 {
+	var dist float64
+	for i := 0; i < len(p1); i++ {
+		d := p1[i] - p2[i]
+		dist += m.Weights[i] * d * d
+	}
+	return math.Sqrt(dist)
+}
+
+func (m WeightedEuclidean) Bounds(center []float64, radius float64, min, max []float64) {
+	for i := 0; i < len(center); i++ {
+		//a dimension with weight 0 does not restrict the distance at all
+		if m.Weights[i] > 0 {
+			min[i], max[i] = intervalFromRadius(center[i], radius/math.Sqrt(m.Weights[i]))
+		} else {
+			min[i], max[i] = math.Inf(-1), math.Inf(1)
+		}
+	}
+}
+
+func (m WeightedEuclidean) DistToNode(point, nodeCenter []float64, nodeRadius float64) float64 {
+	var dist float64
+	for i := 0; i < len(point); i++ {
+		d := distToInterval(point[i], nodeCenter[i], nodeRadius)
+		dist += m.Weights[i] * d * d
+	}
+	return math.Sqrt(dist)
+}
+
+// metricOrDefault returns m, or the metric of the tree if m is nil.
+func (qt *QuadTree[V]) metricOrDefault(m Metric) Metric {
+	if m != nil {
+		return m
+	}
+	if qt.metric != nil {
+		return qt.metric
+	}
+	return Euclidean{}
+}
+
+// boundsFromRadius is used by all metrics where the distance is at least as
+// large as the coordinate difference in any single dimension.
+func boundsFromRadius(center []float64, radius float64, min, max []float64) {
+	for i := 0; i < len(center); i++ {
+		min[i], max[i] = intervalFromRadius(center[i], radius)
+	}
+}
+
+// intervalFromRadius returns [x-radius, x+radius], widened by a margin for
+// rounding errors. Otherwise a point whose computed distance is exactly the
+// radius may lie outside of the interval, for example because math.Pow()
+// or x-radius round differently.
+func intervalFromRadius(x, radius float64) (float64, float64) {
+	r := radius * EPS_MUL
+	return math.Nextafter(x-r, math.Inf(-1)), math.Nextafter(x+r, math.Inf(1))
+}
+
+// distToInterval returns the distance of x to [center-radius, center+radius]
+// in one dimension.
+func distToInterval(x, center, radius float64) float64 {
+	if x > center+radius {
+		return x - (center + radius)
+	} else if x < center-radius {
+		return center - radius - x
+	}
+	return 0
+}
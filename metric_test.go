@@ -0,0 +1,77 @@
+package qthc
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestNewLpRejectsInvalidP(t *testing.T) {
+	for _, p := range []float64{0.5, math.NaN(), math.Inf(1)} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("NewLp(%v) didn't panic", p)
+				}
+			}()
+			NewLp(p)
+		}()
+	}
+	if m := NewLp(3); m.P != 3 {
+		t.Fatalf("P is %v, want 3", m.P)
+	}
+}
+
+func shippedMetrics() []Metric {
+	return []Metric{Euclidean{}, Manhattan{}, Chebyshev{}, NewLp(1.5), NewLp(3),
+		NewWeightedEuclidean([]float64{1, 0.01, 5}), NewWeightedEuclidean([]float64{2, 0, 1})}
+}
+
+func TestDistToNodeIsLowerBound(t *testing.T) {
+	r := rand.New(rand.NewSource(3))
+	for _, m := range shippedMetrics() {
+		for i := 0; i < 2000; i++ {
+			center := []float64{r.NormFloat64() * 10, r.NormFloat64() * 10, r.NormFloat64() * 10}
+			radius := r.Float64() * 5
+			q := []float64{r.NormFloat64() * 10, r.NormFloat64() * 10, r.NormFloat64() * 10}
+			if i%4 == 0 {
+				//inside the node
+				copy(q, center)
+				q[0] += radius / 2
+			}
+			p := make([]float64, 3)
+			for d := range p {
+				p[d] = center[d] + (2*r.Float64()-1)*radius
+			}
+			if dn, dp := m.DistToNode(q, center, radius), m.Distance(q, p); dn > dp {
+				t.Fatalf("%T: DistToNode is %v, distance to %v in the node is %v", m, dn, p, dp)
+			}
+		}
+	}
+}
+
+func TestNearestNeighborMetrics(t *testing.T) {
+	r := rand.New(rand.NewSource(4))
+	qt := NewQuadTree[int](3, 4)
+	var pts [][]float64
+	for i := 0; i < 1000; i++ {
+		p := gridPoint(r, 3, 30)
+		pts = append(pts, p)
+		qt.Insert(p, i)
+	}
+	for _, m := range shippedMetrics() {
+		for q := 0; q < 20; q++ {
+			c := gridPoint(r, 3, 40)
+			for _, k := range []int{1, 7, 50} {
+				checkNearest(t, qt.NearestNeighbor(c, k, m), bruteNearest(pts, c, k, m))
+			}
+			//the iterator returns the same entries
+			it := qt.SearchNearest(c, m)
+			var got []*EntryDist[int]
+			for i := 0; i < 50 && it.HasNext(); i++ {
+				got = append(got, it.Next())
+			}
+			checkNearest(t, got, bruteNearest(pts, c, 50, m))
+		}
+	}
+}
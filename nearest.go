@@ -0,0 +1,153 @@
+package qthc
+
+import (
+	"container/heap"
+)
+
+// NearestIterator returns entries in order of increasing distance from a
+// query point. Nodes are only expanded when they are the closest remaining
+// candidate, so stopping early avoids most of the work.
+type NearestIterator[V any] interface {
+	HasNext() bool
+	Next() *EntryDist[V]
+	Reset(center []float64)
+	// Err returns the error that prevented the last query from running,
+	// for example ErrDimensionMismatch for an invalid center.
+	Err() error
+}
+
+type nearestIterator[V any] struct {
+	tree   *QuadTree[V]
+	center []float64
+	metric Metric
+	queue  nearestQueue[V]
+	next   *EntryDist[V]
+	err    error
+}
+
+func newNearestIterator[V any](tree *QuadTree[V], center []float64, m Metric) *nearestIterator[V] {
+	ans := new(nearestIterator[V])
+	ans.tree = tree
+	ans.metric = m
+	ans.Reset(center)
+
+	return ans
+}
+
+func (it *nearestIterator[V]) HasNext() bool {
+	return it.next != nil
+}
+
+func (it *nearestIterator[V]) Next() *EntryDist[V] {
+	ret := it.next
+	it.findNext()
+	return ret
+}
+
+/**
+ * Reset the iterator. This iterator can be reused in order to reduce load on the
+ * garbage collector.
+ */
+func (it *nearestIterator[V]) Reset(center []float64) {
+	it.clear()
+	it.err = it.tree.checkKey(center)
+	if it.err != nil {
+		return
+	}
+	it.start(center)
+	it.findNext()
+}
+
+func (it *nearestIterator[V]) Err() error {
+	return it.err
+}
+
+// start restarts the search without looking for the first entry.
+func (it *nearestIterator[V]) start(center []float64) {
+	it.clear()
+	it.center = center
+	if it.tree.root != nil {
+		heap.Push(&it.queue, nearestItem[V]{node: it.tree.root, dist: it.metric.DistToNode(center, it.tree.root.center, it.tree.root.radius)})
+	}
+}
+
+// clear empties the queue without keeping nodes and entries alive.
+func (it *nearestIterator[V]) clear() {
+	for i := range it.queue {
+		it.queue[i] = nearestItem[V]{}
+	}
+	it.queue = it.queue[:0]
+	it.center = nil
+	it.next = nil
+}
+
+func (it *nearestIterator[V]) findNext() {
+	it.next = nil
+	if e, dist, ok := it.nextEntry(); ok {
+		it.next = NewEntryDist(e, dist)
+	}
+}
+
+// nextEntry returns the closest remaining entry and its distance.
+func (it *nearestIterator[V]) nextEntry() (*Entry[V], float64, bool) {
+	for len(it.queue) > 0 {
+		item := heap.Pop(&it.queue).(nearestItem[V])
+		if item.entry != nil {
+			return item.entry, item.dist, true
+		}
+
+		node := item.node
+		if node.isLeaf {
+			for i := 0; i < node.nValues; i++ {
+				e := node.values[i]
+				heap.Push(&it.queue, nearestItem[V]{entry: e, dist: it.metric.Distance(it.center, e.point)})
+			}
+			continue
+		}
+		for i := 0; i < node.numSlots(); i++ {
+			c := node.slot(i)
+			if v := c.node; v != nil {
+				heap.Push(&it.queue, nearestItem[V]{node: v, dist: it.metric.DistToNode(it.center, v.center, v.radius)})
+			} else if v := c.entry; v != nil {
+				heap.Push(&it.queue, nearestItem[V]{entry: v, dist: it.metric.Distance(it.center, v.point)})
+			}
+		}
+	}
+	return nil, 0, false
+}
+
+// nearestItem is either a node, keyed by its distance to the query point, or
+// an entry, keyed by its exact distance.
+type nearestItem[V any] struct {
+	node  *Node[V]
+	entry *Entry[V]
+	dist  float64
+}
+
+// nearestQueue is a min-heap. At equal distance, nodes are expanded before
+// entries are returned, and entries are ordered lexicographically. This
+// yields the same order as NearestNeighbor.
+type nearestQueue[V any] []nearestItem[V]
+
+func (q nearestQueue[V]) Len() int { return len(q) }
+func (q nearestQueue[V]) Less(i, j int) bool {
+	if q[i].dist != q[j].dist {
+		return q[i].dist < q[j].dist
+	}
+	if q[i].entry == nil || q[j].entry == nil {
+		return q[i].entry == nil && q[j].entry != nil
+	}
+	return comparePoints(q[i].entry.point, q[j].entry.point) < 0
+}
+func (q nearestQueue[V]) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+func (q *nearestQueue[V]) Push(x interface{}) {
+	*q = append(*q, x.(nearestItem[V]))
+}
+func (q *nearestQueue[V]) Pop() interface{} {
+	old := *q
+	n := len(old)
+	x := old[n-1]
+	old[n-1] = nearestItem[V]{}
+	*q = old[:n-1]
+	return x
+}
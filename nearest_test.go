@@ -0,0 +1,52 @@
+package qthc
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestNearestIteratorOrder(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	for _, dim := range []int{1, 2, 3} {
+		qt := NewQuadTree[int](dim, 4)
+		for i := 0; i < 500; i++ {
+			qt.Insert(gridPoint(r, dim, 15), i)
+		}
+		it := qt.SearchNearest(make([]float64, dim), nil)
+		for q := 0; q < 20; q++ {
+			c := randomPoint(r, dim)
+			for d := range c {
+				c[d] = c[d]*20 - 3
+			}
+			//the same iterator, restarted at a new center
+			it.Reset(c)
+			want := qt.NearestNeighbor(c, qt.Size(), nil)
+			var got []*EntryDist[int]
+			for it.HasNext() {
+				e := it.Next()
+				if len(got) > 0 && e.Dist() < got[len(got)-1].Dist() {
+					t.Fatalf("distance %v after %v", e.Dist(), got[len(got)-1].Dist())
+				}
+				got = append(got, e)
+			}
+			checkNearest(t, got, want)
+		}
+
+		//stop early and start over at the same center
+		c := make([]float64, dim)
+		it.Reset(c)
+		first := it.Next()
+		it.Next()
+		it.Reset(c)
+		if e := it.Next(); e.Dist() != first.Dist() || !isPointEqual(e.point, first.point) {
+			t.Fatalf("Reset returned %v first, want %v", e.point, first.point)
+		}
+	}
+}
+
+func TestNearestIteratorEmptyTree(t *testing.T) {
+	it := NewQuadTree[int](2, 4).SearchNearest([]float64{1, 1}, nil)
+	if it.HasNext() || it.Next() != nil || it.Err() != nil {
+		t.Fatal("iterator over an empty tree is not empty")
+	}
+}
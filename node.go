@@ -1,47 +1,122 @@
 package qthc
 
-import (
-	"log"
-)
-
-type Node struct {
-	center  []float64
-	radius  float64
-	values  []*Entry
-	subs    []interface{}
+type Node[V any] struct {
+	center []float64
+	radius float64
+	values []*Entry[V]
+	//Directory nodes store their subs either densely, indexed by hypercube
+	//position, or sparsely as a list sorted by hypercube position. See
+	//getSub()/setSub().
+	subs       []child[V]
+	sparsePos  []uint64
+	sparseSubs []child[V]
+	//number of occupied slots of a directory node
+	nSubs   int
 	nValues int
-	isLeaf  bool
+	//number of entries in the sub tree of a directory node, see
+	//numEntries()
+	nEntries int
+	isLeaf   bool
+	//generation of the tree that created this node, see mutableSub()
+	gen uint64
+	//coordinate array for the keys of entries that were inserted into this
+	//node, see storeKey(). Entries keep their slice when they move.
+	keys []float64
+	//parent node, only maintained in trees that don't share nodes (gen 0),
+	//see QuadTree.owner()
+	parent *Node[V]
+	//cached aggregates, one per aggregator of the tree. dirty is set when
+	//the sub tree changes, all ancestors of a dirty node are dirty as well.
+	//See QuadTree.updateAggregates().
+	aggs  []interface{}
+	dirty bool
+}
+
+// child is the content of a slot of a directory node: a sub node, an entry
+// or neither. At most one of the pointers is set.
+type child[V any] struct {
+	node  *Node[V]
+	entry *Entry[V]
+}
+
+func nodeChild[V any](n *Node[V]) child[V] {
+	return child[V]{node: n}
 }
 
-func newNode(center []float64, radius float64) *Node {
-	ans := new(Node)
+func entryChild[V any](e *Entry[V]) child[V] {
+	return child[V]{entry: e}
+}
+
+func (c child[V]) isEmpty() bool {
+	return c.node == nil && c.entry == nil
+}
+
+// nodeEvent is called when a node is split or merged, see
+// QuadTree.nodeEvents(). It may be nil.
+type nodeEvent[V any] func(msg string, n *Node[V])
+
+func newNode[V any](center []float64, radius float64) *Node[V] {
+	ans := new(Node[V])
 	ans.center = center
 	ans.radius = radius
-	ans.values = make([]*Entry, 2)
+	ans.values = make([]*Entry[V], 2)
 	ans.isLeaf = true
+	ans.dirty = true
 
 	return ans
 }
 
-func newNodeWithSub(center []float64, radius float64, subNode *Node, subNodePos int) *Node {
-	ans := new(Node)
+func newNodeWithSub[V any](center []float64, radius float64, subNode *Node[V], subNodePos hcPos) *Node[V] {
+	ans := new(Node[V])
 	ans.center = center
 	ans.radius = radius
 	ans.values = nil
-	ans.subs = make([]interface{}, 1<<uint(len(center)))
-	ans.subs[subNodePos] = subNode
 	ans.isLeaf = false
+	ans.dirty = true
+	ans.setSub(subNodePos, nodeChild(subNode))
+	ans.nEntries = subNode.numEntries()
 
 	return ans
 }
 
-func (n *Node) tryPut(e *Entry, maxNodeSize int, enforceLeaf bool) *Node {
-	if DEBUG && !e.enclosedFromCenter(n.center, n.radius) {
-		log.Printf("entry at %.4f: center/radius at %.4f/%.4f \n", e.point, n.center, n.radius)
+// isInside returns whether the box of n is inside min/max. Entries may lie
+// outside of their node by rounding errors, so the box is enlarged by the
+// same tolerance that Validate() accepts.
+func (n *Node[V]) isInside(min, max []float64) bool {
+	for d, c := range n.center {
+		r := n.radius + tolerance(c, n.radius)
+		if c-r < min[d] || c+r > max[d] {
+			return false
+		}
 	}
+	return true
+}
 
+// intersects returns whether the box of n, enlarged like in isInside(),
+// intersects with min/max.
+func (n *Node[V]) intersects(min, max []float64) bool {
+	for d, c := range n.center {
+		r := n.radius + tolerance(c, n.radius)
+		if c+r < min[d] || c-r > max[d] {
+			return false
+		}
+	}
+	return true
+}
+
+// numEntries returns the number of entries in the sub tree of n.
+func (n *Node[V]) numEntries() int {
+	if n.isLeaf {
+		return n.nValues
+	}
+	return n.nEntries
+}
+
+func (n *Node[V]) tryPut(e *Entry[V], maxNodeSize int, enforceLeaf bool, ev nodeEvent[V]) *Node[V] {
 	//traverse subs?
 	if !n.isLeaf {
+		n.nEntries++
+		n.dirty = true
 		return n.getOrCreateSub(e, maxNodeSize, enforceLeaf)
 	}
 
@@ -60,7 +135,6 @@ func (n *Node) tryPut(e *Entry, maxNodeSize int, enforceLeaf bool) *Node {
 	vals := n.values
 	nVal := n.nValues
 	n.clearValues()
-	n.subs = make([]interface{}, 1<<uint(len(n.center)))
 	n.isLeaf = false
 	for i := 0; i < nVal; i++ {
 		e2 := vals[i]
@@ -68,14 +142,31 @@ func (n *Node) tryPut(e *Entry, maxNodeSize int, enforceLeaf bool) *Node {
 		for sub != nil {
 			//This may recurse if all entries fall
 			//into the same subnode
-			sub = sub.tryPut(e2, maxNodeSize, false)
+			sub = sub.tryPut(e2, maxNodeSize, false, ev)
 		}
 	}
+	n.nEntries = nVal + 1
+	if ev != nil {
+		ev("node split", n)
+	}
 
 	return n.getOrCreateSub(e, maxNodeSize, enforceLeaf)
 }
 
-func (n *Node) areAllPointsIdentical(e *Entry) bool {
+// put adds e to the sub tree of n, which must cover e and is at the given
+// depth. If storeKey is set, the point of e is copied into the node that
+// receives e.
+func (n *Node[V]) put(e *Entry[V], maxNodeSize, depth, maxDepth int, storeKey bool, ev nodeEvent[V]) {
+	for r := n; r != nil; depth++ {
+		m := r
+		r = r.tryPut(e, maxNodeSize, depth > maxDepth, ev)
+		if r == nil && storeKey {
+			e.point = m.storeKey(e.point, maxNodeSize)
+		}
+	}
+}
+
+func (n *Node[V]) areAllPointsIdentical(e *Entry[V]) bool {
 	//This discovers situation where a node overflows, but splitting won't help because all points are identical
 	for i := 0; i < n.nValues; i++ {
 		if !e.equals(n.values[i]) {
@@ -86,7 +177,7 @@ func (n *Node) areAllPointsIdentical(e *Entry) bool {
 	return true
 }
 
-func (n *Node) addValue(e *Entry, maxNodeSize int) {
+func (n *Node[V]) addValue(e *Entry[V], maxNodeSize int) {
 	//Allow overflow over max node size (for example for lots of identical values in node)
 	maxLen := maxNodeSize
 	if n.nValues >= maxNodeSize {
@@ -98,93 +189,146 @@ func (n *Node) addValue(e *Entry, maxNodeSize int) {
 		if n.nValues*3 <= maxLen {
 			l = n.nValues * 3
 		}
-		t := make([]*Entry, l)
+		if l <= n.nValues {
+			//merged nodes may start without any capacity
+			l = n.nValues + 2
+		}
+		t := make([]*Entry[V], l)
 		copy(t, n.values)
 		n.values = t
 	}
 	n.values[n.nValues] = e
 	n.nValues++
+	n.dirty = true
+	n.adopt(e)
 }
 
-func (n *Node) removeValue(pos int) {
-	if n.isLeaf {
-		n.nValues--
-		if pos < n.nValues {
-			copy(n.values[pos+1:(pos+1)+(n.nValues-pos)], n.values[pos:pos+(n.nValues-pos)])
-		}
-	} else {
-		n.nValues--
-		n.subs[pos] = nil
+// adopt records n as the node of e. Trees that share nodes don't track
+// nodes, their entries may be shared as well.
+func (n *Node[V]) adopt(e *Entry[V]) {
+	if n.gen == 0 {
+		e.node = n
+	}
+}
+
+func (n *Node[V]) removeValue(pos int) {
+	if n.gen == 0 {
+		n.values[pos].node = nil
+	}
+	n.nValues--
+	n.dirty = true
+	if pos < n.nValues {
+		copy(n.values[pos:pos+(n.nValues-pos)], n.values[pos+1:(pos+1)+(n.nValues-pos)])
 	}
+	n.values[n.nValues] = nil
+}
+
+func (n *Node[V]) removeSubEntry(pos hcPos) {
+	if e := n.getSub(pos).entry; e != nil && n.gen == 0 {
+		e.node = nil
+	}
+	n.nValues--
+	n.nEntries--
+	n.setSub(pos, child[V]{})
 }
 
-func (n *Node) clearValues() {
+func (n *Node[V]) clearValues() {
 	n.values = nil
 	n.nValues = 0
+	n.dirty = true
 }
 
-func (n *Node) getOrCreateSub(e *Entry, maxNodeSize int, enforceLeaf bool) *Node {
-	pos := n.calcSubPosition(e.point)
-	nn := n.subs[pos]
+func (n *Node[V]) getOrCreateSub(e *Entry[V], maxNodeSize int, enforceLeaf bool) *Node[V] {
+	var buf [hcInlineWords]uint64
+	pos := n.calcSubPosition(e.point, buf[:])
+	nn := n.getSub(pos)
 
-	if v, ok := nn.(*Node); ok {
-		return v
+	if nn.node != nil {
+		return n.mutableSub(pos, nn.node)
 	}
 
-	if nn == nil {
-		n.subs[pos] = e
+	if nn.entry == nil {
+		n.setSub(pos, entryChild(e))
 		n.nValues++
 		return nil
 	}
 
-	e2, _ := nn.(*Entry)
+	e2 := nn.entry
 	n.nValues--
 	sub := n.createSubForEntry(pos)
-	n.subs[pos] = sub
-	sub.tryPut(e2, maxNodeSize, enforceLeaf)
+	n.setSub(pos, nodeChild(sub))
+	//a new leaf is never split
+	sub.tryPut(e2, maxNodeSize, enforceLeaf, nil)
 
 	return sub
 }
 
-func (n *Node) createSubForEntry(subNodePos int) *Node {
-	centerSub := make([]float64, len(n.center))
-	mask := 1 << uint(len(n.center))
+func (n *Node[V]) createSubForEntry(subNodePos hcPos) *Node[V] {
+	dim := len(n.center)
+	centerSub := make([]float64, dim)
 	//This ensures that the subsnodes completely cover the area of
 	//the parent node.
 	radiusSub := n.radius / 2.0
-	for d := 0; d < len(n.center); d++ {
-		mask >>= 1
-		if (subNodePos & mask) > 0 {
+	for d := 0; d < dim; d++ {
+		if subNodePos.isSet(dim, d) {
 			centerSub[d] = n.center[d] + radiusSub
 		} else {
 			centerSub[d] = n.center[d] - radiusSub
 		}
 	}
 
-	return newNode(centerSub, radiusSub)
+	ans := newNode[V](centerSub, radiusSub)
+	ans.gen = n.gen
+	return ans
 }
 
-func (n *Node) calcSubPosition(p []float64) int {
-	subNodePos := 0
-	for d := 0; d < len(n.center); d++ {
-		subNodePos <<= 1
+// calcSubPosition returns the hypercube position of p, buf is used as
+// storage if it is large enough.
+func (n *Node[V]) calcSubPosition(p []float64, buf []uint64) hcPos {
+	dim := len(n.center)
+	subNodePos := hcMake(dim, buf)
+	if len(subNodePos) == 1 {
+		var pos uint64
+		for d := 0; d < dim; d++ {
+			pos <<= 1
+			if p[d] >= n.center[d] {
+				pos |= 1
+			}
+		}
+		subNodePos[0] = pos
+		return subNodePos
+	}
+	for d := 0; d < dim; d++ {
 		if p[d] >= n.center[d] {
-			subNodePos |= 1
+			subNodePos.set(dim, d)
 		}
 	}
 
 	return subNodePos
 }
 
-func (n *Node) remove(parent *Node, key []float64, maxNodeSize int) *Entry {
+// remove removes the first entry with the given key that is accepted by
+// match. A nil match accepts any entry.
+func (n *Node[V]) remove(parent *Node[V], key []float64, match func(e *Entry[V]) bool, maxNodeSize int, ev nodeEvent[V]) *Entry[V] {
 	if !n.isLeaf {
-		pos := n.calcSubPosition(key)
-		o := n.subs[pos]
-		if v, ok := o.(*Node); ok {
-			return v.remove(n, key, maxNodeSize)
-		} else if v2, ok2 := o.(*Entry); ok2 {
-			e := v2
-			if n.removeSub(parent, key, pos, e, maxNodeSize) {
+		var buf [hcInlineWords]uint64
+		pos := n.calcSubPosition(key, buf[:])
+		o := n.getSub(pos)
+		if o.node != nil {
+			ret := n.mutableSub(pos, o.node).remove(n, key, match, maxNodeSize, ev)
+			if ret != nil {
+				n.dirty = true
+				//n may have been merged into a leaf
+				if !n.isLeaf {
+					n.nEntries--
+				}
+			}
+			return ret
+		} else if o.entry != nil {
+			e := o.entry
+			if isPointEqual(e.point, key) && (match == nil || match(e)) {
+				n.removeSubEntry(pos)
+				n.removeSub(parent, maxNodeSize, ev)
 				return e
 			}
 		}
@@ -194,7 +338,9 @@ func (n *Node) remove(parent *Node, key []float64, maxNodeSize int) *Entry {
 
 	for i := 0; i < n.nValues; i++ {
 		e := n.values[i]
-		if n.removeSub(parent, key, i, e, maxNodeSize) {
+		if isPointEqual(e.point, key) && (match == nil || match(e)) {
+			n.removeValue(i)
+			n.removeSub(parent, maxNodeSize, ev)
 			return e
 		}
 	}
@@ -202,69 +348,69 @@ func (n *Node) remove(parent *Node, key []float64, maxNodeSize int) *Entry {
 	return nil
 }
 
-func (n *Node) removeSub(parent *Node, key []float64, pos int, e *Entry, maxNodeSize int) bool {
-	if isPointEqual(e.point, key) {
-		n.removeValue(pos)
-		//TODO provide threshold for re-insert
-		//i.e. do not always merge.
-		if parent != nil {
-			parent.checkAndMergeLeafNodes(maxNodeSize)
-		}
-		return true
+func (n *Node[V]) removeSub(parent *Node[V], maxNodeSize int, ev nodeEvent[V]) {
+	//TODO provide threshold for re-insert
+	//i.e. do not always merge.
+	if parent != nil {
+		parent.checkAndMergeLeafNodes(maxNodeSize, ev)
 	}
-	return false
 }
 
-func (n *Node) update(parent *Node, keyOld, keyNew []float64, maxNodeSize int, requiresReinsert []bool, currentDepth, maxDepth int) *Entry {
+// update moves the entry at keyOld to keyNew. If storeKey is set, keyNew is
+// copied into the node that receives the entry.
+func (n *Node[V]) update(parent *Node[V], keyOld, keyNew []float64, maxNodeSize int, requiresReinsert []bool, currentDepth, maxDepth int, storeKey bool, ev nodeEvent[V]) *Entry[V] {
 	if !n.isLeaf {
-		pos := n.calcSubPosition(keyOld)
-		e := n.subs[pos]
-		if e == nil {
+		var buf [hcInlineWords]uint64
+		pos := n.calcSubPosition(keyOld, buf[:])
+		c := n.getSub(pos)
+		if c.isEmpty() {
 			return nil
 		}
-		if v, ok := e.(*Node); ok {
-			sub := v
-			ret := sub.update(n, keyOld, keyNew, maxNodeSize, requiresReinsert, currentDepth+1, maxDepth)
+		if c.node != nil {
+			sub := n.mutableSub(pos, c.node)
+			ret := sub.update(n, keyOld, keyNew, maxNodeSize, requiresReinsert, currentDepth+1, maxDepth, storeKey, ev)
+			if ret != nil {
+				n.dirty = true
+			}
+			if ret != nil && requiresReinsert[0] && !n.isLeaf {
+				//the entry left the sub tree
+				n.nEntries--
+			}
 			if ret != nil && requiresReinsert[0] && isPointEnclosedFromCenter(ret.point, n.center, n.radius/EPS_MUL) {
 				requiresReinsert[0] = false
-				r := n
-				for r != nil {
-					r = r.tryPut(ret, maxNodeSize, currentDepth > maxDepth)
-					currentDepth++
-				}
+				n.put(ret, maxNodeSize, currentDepth, maxDepth, storeKey, ev)
 			}
 
 			return ret
 		}
 		//Entry
-		qe, _ := e.(*Entry)
+		qe := c.entry
 		if isPointEqual(qe.point, keyOld) {
-			n.removeValue(pos)
+			n.removeSubEntry(pos)
+			qe = n.mutableEntry(qe)
 			qe.point = keyNew
 			if isPointEnclosedFromCenter(keyNew, n.center, n.radius/EPS_MUL) {
 				//reinsert locally;
-				r := n
-				for r != nil {
-					r = r.tryPut(qe, maxNodeSize, currentDepth > maxDepth)
-					currentDepth++
-				}
+				n.put(qe, maxNodeSize, currentDepth, maxDepth, storeKey, ev)
 				requiresReinsert[0] = false
 			} else {
 				requiresReinsert[0] = true
 				if parent != nil {
-					parent.checkAndMergeLeafNodes(maxNodeSize)
+					parent.checkAndMergeLeafNodes(maxNodeSize, ev)
 				}
 			}
 			return qe
 		}
+		return nil
 	}
 
 	for i := 0; i < n.nValues; i++ {
 		e := n.values[i]
 		if isPointEqual(e.point, keyOld) {
 			n.removeValue(i)
+			e = n.mutableEntry(e)
 			e.point = keyNew
-			n.updateSub(keyNew, e, parent, maxNodeSize, requiresReinsert)
+			n.updateSub(keyNew, e, parent, maxNodeSize, requiresReinsert, storeKey, ev)
 			return e
 		}
 	}
@@ -273,28 +419,29 @@ func (n *Node) update(parent *Node, keyOld, keyNew []float64, maxNodeSize int, r
 	return nil
 }
 
-func (n *Node) updateSub(keyNew []float64, e *Entry, parent *Node, maxNodeSize int, requiresReinsert []bool) {
+func (n *Node[V]) updateSub(keyNew []float64, e *Entry[V], parent *Node[V], maxNodeSize int, requiresReinsert []bool, storeKey bool, ev nodeEvent[V]) {
 	if isPointEnclosedFromCenter(keyNew, n.center, n.radius/EPS_MUL) {
 		//reinsert locally;
 		n.addValue(e, maxNodeSize)
+		if storeKey {
+			e.point = n.storeKey(e.point, maxNodeSize)
+		}
 		requiresReinsert[0] = false
 	} else {
 		requiresReinsert[0] = true
 		//TODO provide threshold for re-insert
 		//i.e. do not always merge.
 		if parent != nil {
-			parent.checkAndMergeLeafNodes(maxNodeSize)
+			parent.checkAndMergeLeafNodes(maxNodeSize, ev)
 		}
 	}
 }
 
-func (n *Node) checkAndMergeLeafNodes(maxNodeSize int) {
+func (n *Node[V]) checkAndMergeLeafNodes(maxNodeSize int, ev nodeEvent[V]) {
 	//check: We start with including all local values: nValues
 	nTotal := n.nValues
-	for i := 0; i < len(n.subs); i++ {
-		e := n.subs[i]
-		if v, ok := e.(*Node); ok {
-			sub := v
+	for i := 0; i < n.numSlots(); i++ {
+		if sub := n.slot(i).node; sub != nil {
 			if !sub.isLeaf {
 				//can't merge directory nodes.
 				//Merge only makes sense if we switch to list-mode, for which we don;t support subnodes!
@@ -309,37 +456,72 @@ func (n *Node) checkAndMergeLeafNodes(maxNodeSize int) {
 	}
 
 	//okay, let's merge
-	n.values = make([]*Entry, nTotal)
+	n.values = make([]*Entry[V], nTotal)
 	n.nValues = 0
-	for i := 0; i < len(n.subs); i++ {
-		e := n.subs[i]
-		if v, ok := e.(*Node); ok {
-			sub := v
+	for i := 0; i < n.numSlots(); i++ {
+		c := n.slot(i)
+		if sub := c.node; sub != nil {
 			for j := 0; j < sub.nValues; j++ {
 				n.values[n.nValues] = sub.values[j]
+				n.adopt(sub.values[j])
 				n.nValues++
 			}
-		} else if v2, ok2 := e.(*Entry); ok2 {
-			n.values[n.nValues] = v2
+		} else if c.entry != nil {
+			n.values[n.nValues] = c.entry
+			n.adopt(c.entry)
 			n.nValues++
 		}
 	}
 
-	n.subs = nil
+	n.clearSubs()
 	n.isLeaf = true
+	n.dirty = true
+	if ev != nil {
+		ev("nodes merged", n)
+	}
 }
 
-func (n *Node) getExact(key []float64) *Entry {
+func (n *Node[V]) getExact(key []float64) *Entry[V] {
 	if !n.isLeaf {
-		pos := n.calcSubPosition(key)
-		sub := n.subs[pos]
-		if v, ok := sub.(*Node); ok {
-			return v.getExact(key)
-		} else if sub != nil {
-			e, _ := sub.(*Entry)
-			if isPointEqual(e.point, key) {
-				return e
+		var buf [hcInlineWords]uint64
+		sub := n.getSub(n.calcSubPosition(key, buf[:]))
+		if sub.node != nil {
+			return sub.node.getExact(key)
+		} else if e := sub.entry; e != nil && isPointEqual(e.point, key) {
+			return e
+		}
+		return nil
+	}
+
+	for i := 0; i < n.nValues; i++ {
+		e := n.values[i]
+		if isPointEqual(e.point, key) {
+			return e
+		}
+	}
+
+	return nil
+}
+
+// getExactMutable works like getExact() but returns an entry whose value may
+// be changed. The path to the entry is copied if necessary.
+func (n *Node[V]) getExactMutable(key []float64) *Entry[V] {
+	if !n.isLeaf {
+		var buf [hcInlineWords]uint64
+		pos := n.calcSubPosition(key, buf[:])
+		sub := n.getSub(pos)
+		if sub.node != nil {
+			//the caller may change the value
+			e := n.mutableSub(pos, sub.node).getExactMutable(key)
+			n.dirty = n.dirty || e != nil
+			return e
+		} else if e := sub.entry; e != nil && isPointEqual(e.point, key) {
+			if n.gen != 0 {
+				e = n.mutableEntry(e)
+				n.setSub(pos, entryChild(e))
 			}
+			n.dirty = true
+			return e
 		}
 		return nil
 	}
@@ -347,6 +529,11 @@ func (n *Node) getExact(key []float64) *Entry {
 	for i := 0; i < n.nValues; i++ {
 		e := n.values[i]
 		if isPointEqual(e.point, key) {
+			if n.gen != 0 {
+				e = n.mutableEntry(e)
+				n.values[i] = e
+			}
+			n.dirty = true
 			return e
 		}
 	}
@@ -354,15 +541,303 @@ func (n *Node) getExact(key []float64) *Entry {
 	return nil
 }
 
-func (n *Node) entries() []interface{} {
+// getAll appends the values of all entries with the given key to r. Such
+// entries are always in the same node.
+func (n *Node[V]) getAll(key []float64, r []V) []V {
+	if !n.isLeaf {
+		var buf [hcInlineWords]uint64
+		sub := n.getSub(n.calcSubPosition(key, buf[:]))
+		if sub.node != nil {
+			return sub.node.getAll(key, r)
+		} else if e := sub.entry; e != nil && isPointEqual(e.point, key) {
+			r = append(r, e.value)
+		}
+		return r
+	}
+
+	for i := 0; i < n.nValues; i++ {
+		e := n.values[i]
+		if isPointEqual(e.point, key) {
+			r = append(r, e.value)
+		}
+	}
+
+	return r
+}
+
+// mutableSub returns a sub node that may be modified. Trees that share nodes
+// with snapshots (gen != 0) never modify nodes of an older generation, they
+// are copied instead and the copy replaces the original in this node. This
+// node must already belong to the current generation.
+func (n *Node[V]) mutableSub(pos hcPos, sub *Node[V]) *Node[V] {
+	if sub.gen == n.gen {
+		return sub
+	}
+	c := sub.copy(n.gen)
+	n.setSub(pos, nodeChild(c))
+	return c
+}
+
+// mutableSlot works like mutableSub() for the sub node in slot i.
+func (n *Node[V]) mutableSlot(i int, sub *Node[V]) *Node[V] {
+	if sub.gen == n.gen {
+		return sub
+	}
+	c := sub.copy(n.gen)
+	if n.subs != nil {
+		n.subs[i] = nodeChild(c)
+	} else {
+		n.sparseSubs[i] = nodeChild(c)
+	}
+	return c
+}
+
+// mutableEntry returns an entry whose point may be changed. Entries of trees
+// that share nodes with snapshots are immutable.
+func (n *Node[V]) mutableEntry(e *Entry[V]) *Entry[V] {
+	if n.gen == 0 {
+		return e
+	}
+	return NewEntry(e.point, e.value)
+}
+
+// storeKey copies key into the coordinate array of n and returns the copy.
+// The array grows in blocks up to maxNodeSize keys, existing copies are
+// never moved or overwritten.
+func (n *Node[V]) storeKey(key []float64, maxNodeSize int) []float64 {
+	dim := len(key)
+	if cap(n.keys)-len(n.keys) < dim {
+		c := min(2*cap(n.keys), maxNodeSize*dim)
+		n.keys = make([]float64, 0, max(c, dim))
+	}
+	start := len(n.keys)
+	n.keys = append(n.keys, key...)
+	return n.keys[start : start+dim : start+dim]
+}
+
+// packKeys copies the keys of all entries of the sub tree of n into one
+// coordinate array per node, which frees the space of removed entries.
+// n must belong to the current generation.
+func (n *Node[V]) packKeys() {
+	dim := len(n.center)
 	if n.isLeaf {
-		r := make([]interface{}, len(n.values))
-		for i := 0; i < len(n.values); i++ {
-			r[i] = n.values[i]
+		n.keys = make([]float64, 0, n.nValues*dim)
+		for i := 0; i < n.nValues; i++ {
+			e := n.mutableEntry(n.values[i])
+			e.point = n.storeKey(e.point, n.nValues)
+			n.values[i] = e
+			n.adopt(e)
+		}
+		return
+	}
+	n.keys = make([]float64, 0, n.nValues*dim)
+	pos := make(hcPos, hcWords(dim))
+	for i := 0; i < n.numSlots(); i++ {
+		if n.subs != nil {
+			pos[0] = uint64(i)
+		} else {
+			copy(pos, n.slotPos(i))
+		}
+		c := n.slot(i)
+		if c.node != nil {
+			n.mutableSub(pos, c.node).packKeys()
+		} else if c.entry != nil {
+			e := n.mutableEntry(c.entry)
+			e.point = n.storeKey(e.point, n.nValues)
+			n.setSub(pos, entryChild(e))
 		}
+	}
+}
 
-		return r
+func (n *Node[V]) copy(gen uint64) *Node[V] {
+	ans := new(Node[V])
+	*ans = *n
+	ans.gen = gen
+	//the array may be shared with other generations, don't append to it
+	ans.keys = nil
+	if n.values != nil {
+		ans.values = make([]*Entry[V], len(n.values))
+		copy(ans.values, n.values)
+	}
+	if n.subs != nil {
+		ans.subs = make([]child[V], len(n.subs))
+		copy(ans.subs, n.subs)
+	}
+	if n.sparseSubs != nil {
+		ans.sparsePos = append([]uint64(nil), n.sparsePos...)
+		ans.sparseSubs = append([]child[V](nil), n.sparseSubs...)
 	}
+	if n.aggs != nil {
+		ans.aggs = append([]interface{}(nil), n.aggs...)
+	}
+	return ans
+}
+
+const (
+	//Directory nodes with more dimensions always use sparse storage,
+	//dense storage would require 2^dim slots.
+	maxDenseDim = 10
+)
 
-	return n.subs
+// numSlots returns the number of slots of a directory node. For dense nodes
+// this is 2^dim and slot(i) is empty for empty slots, for sparse nodes it
+// is the number of subs.
+func (n *Node[V]) numSlots() int {
+	if n.subs != nil {
+		return len(n.subs)
+	}
+	return len(n.sparseSubs)
+}
+
+func (n *Node[V]) slot(i int) child[V] {
+	if n.subs != nil {
+		return n.subs[i]
+	}
+	return n.sparseSubs[i]
+}
+
+// slotPos returns the hypercube position of sparse slot i.
+func (n *Node[V]) slotPos(i int) hcPos {
+	w := hcWords(len(n.center))
+	return n.sparsePos[i*w : (i+1)*w : (i+1)*w]
+}
+
+func (n *Node[V]) getSub(pos hcPos) child[V] {
+	if n.subs != nil {
+		return n.subs[pos[0]]
+	}
+	if i, found := n.findSparse(pos); found {
+		return n.sparseSubs[i]
+	}
+	return child[V]{}
+}
+
+// setSub stores a sub node or entry at the given position, an empty child
+// clears the slot. Depending on the number of occupied slots, the node
+// switches between dense and sparse storage.
+func (n *Node[V]) setSub(pos hcPos, sub child[V]) {
+	n.dirty = true
+	if n.gen == 0 {
+		if sub.node != nil && sub.node.gen == 0 {
+			sub.node.parent = n
+		} else if sub.entry != nil {
+			sub.entry.node = n
+		}
+	}
+	if n.subs != nil {
+		old := n.subs[pos[0]]
+		n.subs[pos[0]] = sub
+		if old.isEmpty() && !sub.isEmpty() {
+			n.nSubs++
+		} else if !old.isEmpty() && sub.isEmpty() {
+			n.nSubs--
+			if !n.preferDense(n.nSubs, true) {
+				n.toSparse()
+			}
+		}
+		return
+	}
+
+	i, found := n.findSparse(pos)
+	if found {
+		if !sub.isEmpty() {
+			n.sparseSubs[i] = sub
+			return
+		}
+		w := len(pos)
+		copy(n.sparsePos[i*w:], n.sparsePos[(i+1)*w:])
+		n.sparsePos = n.sparsePos[:len(n.sparsePos)-w]
+		copy(n.sparseSubs[i:], n.sparseSubs[i+1:])
+		n.sparseSubs[len(n.sparseSubs)-1] = child[V]{}
+		n.sparseSubs = n.sparseSubs[:len(n.sparseSubs)-1]
+		n.nSubs--
+		return
+	}
+	if sub.isEmpty() {
+		return
+	}
+	n.sparsePos = append(n.sparsePos, pos...)
+	copy(n.sparsePos[(i+1)*len(pos):], n.sparsePos[i*len(pos):])
+	copy(n.sparsePos[i*len(pos):], pos)
+	n.sparseSubs = append(n.sparseSubs, child[V]{})
+	copy(n.sparseSubs[i+1:], n.sparseSubs[i:])
+	n.sparseSubs[i] = sub
+	n.nSubs++
+	if n.preferDense(n.nSubs, false) {
+		n.toDense()
+	}
+}
+
+// findSparse performs a binary search for pos. If pos is not found, the
+// returned index is where it would have to be inserted.
+func (n *Node[V]) findSparse(pos hcPos) (int, bool) {
+	lo, hi := 0, len(n.sparseSubs)
+	for lo < hi {
+		mid := int(uint(lo+hi) >> 1)
+		c := n.slotPos(mid).compare(pos)
+		if c == 0 {
+			return mid, true
+		}
+		if c < 0 {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	return lo, false
+}
+
+// preferDense decides about the storage of directory nodes. A dense slot
+// costs roughly a third of a sparse one, the hysteresis avoids switching
+// back and forth.
+func (n *Node[V]) preferDense(nSubs int, isDense bool) bool {
+	dim := len(n.center)
+	if dim > maxDenseDim {
+		return false
+	}
+	if isDense {
+		return nSubs*6 >= 1<<uint(dim)
+	}
+	return nSubs*3 >= 1<<uint(dim)
+}
+
+// initSubs prepares the storage of an empty directory node for the given
+// number of subs.
+func (n *Node[V]) initSubs(nSubs int) {
+	if n.preferDense(nSubs, false) {
+		n.subs = make([]child[V], 1<<uint(len(n.center)))
+	} else {
+		n.sparsePos = make([]uint64, 0, nSubs*hcWords(len(n.center)))
+		n.sparseSubs = make([]child[V], 0, nSubs)
+	}
+}
+
+func (n *Node[V]) toDense() {
+	subs := make([]child[V], 1<<uint(len(n.center)))
+	for i := 0; i < len(n.sparseSubs); i++ {
+		subs[n.slotPos(i)[0]] = n.sparseSubs[i]
+	}
+	n.sparsePos = nil
+	n.sparseSubs = nil
+	n.subs = subs
+}
+
+func (n *Node[V]) toSparse() {
+	subs := n.subs
+	n.subs = nil
+	n.sparsePos = make([]uint64, 0, n.nSubs)
+	n.sparseSubs = make([]child[V], 0, n.nSubs)
+	for i := 0; i < len(subs); i++ {
+		if !subs[i].isEmpty() {
+			n.sparsePos = append(n.sparsePos, uint64(i))
+			n.sparseSubs = append(n.sparseSubs, subs[i])
+		}
+	}
+}
+
+func (n *Node[V]) clearSubs() {
+	n.subs = nil
+	n.sparsePos = nil
+	n.sparseSubs = nil
+	n.nSubs = 0
 }
@@ -0,0 +1,22 @@
+package qthc
+
+import "testing"
+
+func TestRemoveValueFromMiddleOfLeaf(t *testing.T) {
+	n := newNode[int]([]float64{0, 0}, 1)
+	for i := 0; i < 4; i++ {
+		n.addValue(NewEntry([]float64{float64(i) / 10, 0}, i), 10)
+	}
+	n.removeValue(1)
+	if n.nValues != 3 {
+		t.Fatalf("nValues is %d, want 3", n.nValues)
+	}
+	for i, want := range []int{0, 2, 3} {
+		if n.values[i] == nil || n.values[i].value != want {
+			t.Fatalf("value %d is %v, want %d", i, n.values[i], want)
+		}
+	}
+	if n.values[3] != nil {
+		t.Fatal("freed value slot is not cleared")
+	}
+}
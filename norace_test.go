@@ -0,0 +1,5 @@
+//go:build !race
+
+package qthc
+
+const raceEnabled = false
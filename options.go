@@ -0,0 +1,130 @@
+package qthc
+
+import (
+	"fmt"
+	"log/slog"
+)
+
+// Option configures a tree created by New().
+type Option func(c *config)
+
+type config struct {
+	maxNodeSize int
+	maxDepth    int
+	min, max    []float64
+	oob         OutOfBoundsPolicy
+	policy      DuplicatePolicy
+	metric      Metric
+	logger      *slog.Logger
+	keys        KeyPolicy
+}
+
+// WithMaxNodeSize sets the number of entries a leaf holds before it is
+// split, at least 1. The default is DEFAULT_MAX_NODE_SIZE, or 2*dim if that
+// is larger.
+func WithMaxNodeSize(n int) Option {
+	return func(c *config) {
+		c.maxNodeSize = n
+	}
+}
+
+// WithMaxDepth sets the depth below which nodes are not split anymore, at
+// least 0. The default is MAX_DEPTH.
+func WithMaxDepth(d int) Option {
+	return func(c *config) {
+		c.maxDepth = d
+	}
+}
+
+// WithBounds sets the domain of the tree, see NewQuadTreeWithBounds().
+func WithBounds(min, max []float64, oob OutOfBoundsPolicy) Option {
+	return func(c *config) {
+		c.min = min
+		c.max = max
+		c.oob = oob
+	}
+}
+
+// WithDuplicatePolicy sets how entries with the same point are treated. The
+// default is Multimap.
+func WithDuplicatePolicy(p DuplicatePolicy) Option {
+	return func(c *config) {
+		c.policy = p
+	}
+}
+
+// WithMetric sets the metric that distance queries use when they are called
+// with a nil metric. The default is Euclidean.
+func WithMetric(m Metric) Option {
+	return func(c *config) {
+		c.metric = m
+	}
+}
+
+// WithLogger sets a logger for diagnostic events, by default there are
+// none. Root growth, node splits and merges and failed removals and updates
+// are logged at debug level, rejected out-of-bounds points at warn level.
+// Use l.With() to tell several trees apart.
+func WithLogger(l *slog.Logger) Option {
+	return func(c *config) {
+		c.logger = l
+	}
+}
+
+// WithKeyPolicy sets whether the tree copies keys. The default is CopyKeys.
+func WithKeyPolicy(p KeyPolicy) Option {
+	return func(c *config) {
+		c.keys = p
+	}
+}
+
+// New creates an empty tree with dim dimensions. It panics if dim is not
+// positive or an option has an invalid value.
+func New[V any](dim int, opts ...Option) *QuadTree[V] {
+	if dim <= 0 {
+		panic(fmt.Sprintf("qthc: bad number of dimensions %d", dim))
+	}
+	c := new(config)
+	c.maxNodeSize = DEFAULT_MAX_NODE_SIZE
+	if 2*dim > DEFAULT_MAX_NODE_SIZE {
+		c.maxNodeSize = 2 * dim
+	}
+	c.maxDepth = MAX_DEPTH
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.maxNodeSize < 1 {
+		panic(fmt.Sprintf("qthc: bad max node size %d", c.maxNodeSize))
+	}
+	if c.maxDepth < 0 {
+		panic(fmt.Sprintf("qthc: bad max depth %d", c.maxDepth))
+	}
+
+	ans := new(QuadTree[V])
+	ans.dim = dim
+	ans.maxNodeSize = c.maxNodeSize
+	ans.maxDepth = c.maxDepth
+	ans.policy = c.policy
+	ans.metric = c.metric
+	ans.logger = c.logger
+	ans.keys = c.keys
+	ans.pools = new(seqPools)
+	if c.min != nil || c.max != nil {
+		ans.setBounds(c.min, c.max, c.oob)
+	}
+	if ans.logs(slog.LevelDebug) {
+		ans.log(slog.LevelDebug, "tree created", slog.Int("dim", dim), slog.Int("maxNodeSize", ans.maxNodeSize))
+	}
+	return ans
+}
+
+// setBounds sets the domain, see NewQuadTreeWithBounds().
+func (qt *QuadTree[V]) setBounds(min, max []float64, oob OutOfBoundsPolicy) {
+	if len(min) != qt.dim || len(max) != qt.dim {
+		panic(fmt.Sprintf("qthc: bounds must have %d dimensions", qt.dim))
+	}
+	qt.domainMin = append([]float64(nil), min...)
+	qt.domainMax = append([]float64(nil), max...)
+	qt.domainCenter, qt.domainRadius = boundsBox(min, max)
+	qt.oob = oob
+}
@@ -0,0 +1,74 @@
+package qthc
+
+import (
+	"math"
+	"testing"
+)
+
+func TestOptionsArePerTree(t *testing.T) {
+	var key []float64
+	a := New[int](2, WithMaxNodeSize(3), WithMaxDepth(1), WithMetric(Manhattan{}),
+		WithKeyPolicy(BorrowKeys), WithDuplicatePolicy(Map))
+	b := New[int](2)
+	for i := 0; i < 100; i++ {
+		key = []float64{float64(i%10) / 1000, float64(i/10) / 1000}
+		a.Insert(key, i)
+		b.Insert(key, i)
+		a.Insert(key, i)
+		b.Insert(key, i)
+	}
+	if a.Size() != 100 || b.Size() != 200 {
+		t.Errorf("sizes are %d and %d, want 100 and 200", a.Size(), b.Size())
+	}
+	sa, sb := a.Stats(), b.Stats()
+	if sa.MaxNodeSize != 3 || sb.MaxNodeSize != DEFAULT_MAX_NODE_SIZE {
+		t.Errorf("max node sizes are %d and %d", sa.MaxNodeSize, sb.MaxNodeSize)
+	}
+	//a doesn't split below depth 1
+	if sa.MaxDepth != 2 || sb.MaxDepth <= 2 {
+		t.Errorf("depths are %d and %d", sa.MaxDepth, sb.MaxDepth)
+	}
+	//the center is 0.0005 away from the grid in both dimensions
+	center := []float64{0.0035, 0.0045}
+	if d := a.NearestNeighbor(center, 1, nil)[0].Dist(); math.Abs(d-0.001) > 1e-12 {
+		t.Errorf("distance in a is %v, want the Manhattan distance", d)
+	}
+	if d := b.NearestNeighbor(center, 1, nil)[0].Dist(); math.Abs(d-math.Sqrt(0.0005*0.0005*2)) > 1e-12 {
+		t.Errorf("distance in b is %v, want the Euclidean distance", d)
+	}
+	//a stores key itself, b a copy
+	ea, eb := a.root.getExact(key), b.root.getExact(key)
+	if &ea.point[0] != &key[0] || &eb.point[0] == &key[0] {
+		t.Error("key policies are mixed up")
+	}
+	if err := a.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBadOptionsPanic(t *testing.T) {
+	for _, c := range []struct {
+		dim  int
+		opts []Option
+	}{
+		{0, nil},
+		{-1, nil},
+		{2, []Option{WithMaxNodeSize(0)}},
+		{2, []Option{WithMaxNodeSize(-1)}},
+		{2, []Option{WithMaxDepth(-1)}},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("New(%d, %v) doesn't panic", c.dim, c.opts)
+				}
+			}()
+			New[int](c.dim, c.opts...)
+		}()
+	}
+	//valid extremes
+	New[int](1, WithMaxNodeSize(1), WithMaxDepth(0))
+}
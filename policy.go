@@ -0,0 +1,174 @@
+package qthc
+
+import (
+	"reflect"
+	"sort"
+)
+
+// DuplicatePolicy defines how a tree treats several entries with the same
+// point.
+type DuplicatePolicy int
+
+const (
+	// Multimap allows any number of entries per point. Insert always adds
+	// a new entry. This is the default.
+	Multimap DuplicatePolicy = iota
+	// Map allows at most one entry per point. Insert replaces the value of
+	// an existing entry.
+	Map
+)
+
+// NewQuadTreeWithPolicy creates an empty tree with the given duplicate
+// policy.
+func NewQuadTreeWithPolicy[V any](dim, maxNodeSize int, policy DuplicatePolicy) *QuadTree[V] {
+	return New[V](dim, WithMaxNodeSize(maxNodeSize), WithDuplicatePolicy(policy))
+}
+
+func (qt *QuadTree[V]) Policy() DuplicatePolicy {
+	return qt.policy
+}
+
+// Put sets the value for key and returns the previous value. The boolean is
+// false if there was no entry with that key. In multimap mode Put replaces
+// the value of the first entry with that key, like Get returns it.
+func (qt *QuadTree[V]) Put(key []float64, value V) (V, bool, error) {
+	_, old, ok, err := qt.set(key, value)
+	return old, ok, err
+}
+
+// set works like Put() and also returns the entry that holds value.
+func (qt *QuadTree[V]) set(key []float64, value V) (*Entry[V], V, bool, error) {
+	var zero V
+	if err := qt.checkKey(key); err != nil {
+		return nil, zero, false, err
+	}
+	if qt.root == nil || qt.root.getExact(key) == nil {
+		e, err := qt.insert(key, value)
+		return e, zero, false, err
+	}
+	qt.mutableRoot()
+	e := qt.root.getExactMutable(key)
+	old := e.value
+	e.value = value
+	qt.updateAggregates()
+	return e, old, true, nil
+}
+
+// PutIfAbsent inserts value unless there is already an entry with key. It
+// returns the value that is now stored for key and whether that value was
+// already there.
+func (qt *QuadTree[V]) PutIfAbsent(key []float64, value V) (V, bool, error) {
+	if old, ok, err := qt.Get(key); ok || err != nil {
+		return old, ok, err
+	}
+	if _, err := qt.insert(key, value); err != nil {
+		var zero V
+		return zero, false, err
+	}
+	return value, false, nil
+}
+
+// Compute calls fn with the current value for key, exists is false if there
+// is no such entry. If fn returns keep == true the returned value is stored
+// for key, otherwise the entry is removed. Compute returns the value that
+// is now stored for key and whether there is one. fn must not modify the
+// tree.
+func (qt *QuadTree[V]) Compute(key []float64, fn func(old V, exists bool) (value V, keep bool)) (V, bool, error) {
+	var zero V
+	old, exists, err := qt.Get(key)
+	if err != nil {
+		return zero, false, err
+	}
+	value, keep := fn(old, exists)
+	switch {
+	case keep && exists:
+		qt.mutableRoot()
+		qt.root.getExactMutable(key).value = value
+		qt.updateAggregates()
+	case keep:
+		if _, err := qt.insert(key, value); err != nil {
+			return zero, false, err
+		}
+	case exists:
+		_, _, err := qt.Remove(key)
+		return zero, false, err
+	default:
+		return zero, false, nil
+	}
+	return value, true, nil
+}
+
+// GetAll returns the values of all entries with the given key, in the order
+// in which they were inserted.
+func (qt *QuadTree[V]) GetAll(key []float64) ([]V, error) {
+	if err := qt.checkKey(key); err != nil {
+		return nil, err
+	}
+	if qt.root == nil {
+		return nil, nil
+	}
+	return qt.root.getAll(key, nil), nil
+}
+
+// RemoveValue removes one entry with the given key and value. It returns
+// false if there is no such entry. Values are compared with == if their
+// type is comparable, otherwise with reflect.DeepEqual().
+func (qt *QuadTree[V]) RemoveValue(key []float64, value V) (bool, error) {
+	if err := qt.checkKey(key); err != nil {
+		return false, err
+	}
+	if qt.root == nil {
+		return false, nil
+	}
+	qt.mutableRoot()
+	e := qt.root.remove(nil, key, func(e *Entry[V]) bool {
+		return valuesEqual(e.value, value)
+	}, qt.maxNodeSize, qt.nodeEvents())
+	if e == nil {
+		return false, nil
+	}
+	qt.size--
+	qt.afterRemove(1)
+	return true, nil
+}
+
+func valuesEqual[V any](a, b V) bool {
+	va, vb := any(a), any(b)
+	t := reflect.TypeOf(va)
+	if t != reflect.TypeOf(vb) {
+		return false
+	}
+	if t == nil {
+		//both nil interfaces
+		return true
+	}
+	if t.Comparable() {
+		return va == vb
+	}
+	return reflect.DeepEqual(va, vb)
+}
+
+// mergeDuplicates returns, for each distinct point, the index of its first
+// and its last occurrence, in the order of the first occurrences. This is
+// what remains after inserting all points into a map: the entry is created
+// by the first occurrence and holds the value of the last one.
+func mergeDuplicates(points [][]float64) [][2]int {
+	idx := make([]int, len(points))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(i, j int) bool {
+		return comparePoints(points[idx[i]], points[idx[j]]) < 0
+	})
+	var r [][2]int
+	for i := 0; i < len(idx); {
+		j := i + 1
+		for j < len(idx) && isPointEqual(points[idx[i]], points[idx[j]]) {
+			j++
+		}
+		r = append(r, [2]int{idx[i], idx[j-1]})
+		i = j
+	}
+	sort.Slice(r, func(i, j int) bool { return r[i][0] < r[j][0] })
+	return r
+}
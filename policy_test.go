@@ -0,0 +1,228 @@
+package qthc
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+func TestMultimapPolicy(t *testing.T) {
+	qt := NewQuadTree[int](2, 2)
+	p, q := []float64{1, 1}, []float64{2, 2}
+	for i := 0; i < 5; i++ {
+		qt.Insert(p, i)
+	}
+	qt.Insert(q, 10)
+	if all, _ := qt.GetAll(p); !slices.Equal(all, []int{0, 1, 2, 3, 4}) {
+		t.Fatalf("GetAll returns %v", all)
+	}
+
+	//Put and Compute change the first entry, like Get returns it
+	if old, ok, _ := qt.Put(p, 5); !ok || old != 0 {
+		t.Errorf("Put returns %d, %v", old, ok)
+	}
+	if v, ok, _ := qt.PutIfAbsent(p, 6); !ok || v != 5 {
+		t.Errorf("PutIfAbsent returns %d, %v", v, ok)
+	}
+	if v, ok, _ := qt.Compute(p, func(old int, exists bool) (int, bool) {
+		return old + 1, exists
+	}); !ok || v != 6 {
+		t.Errorf("Compute returns %d, %v", v, ok)
+	}
+	if all, _ := qt.GetAll(p); !slices.Equal(all, []int{6, 1, 2, 3, 4}) {
+		t.Fatalf("GetAll returns %v", all)
+	}
+
+	//Compute removes only the first entry
+	if _, ok, _ := qt.Compute(p, func(old int, exists bool) (int, bool) {
+		return 0, false
+	}); ok {
+		t.Error("Compute keeps the entry")
+	}
+	if ok, _ := qt.RemoveValue(p, 3); !ok {
+		t.Error("RemoveValue doesn't find 3")
+	}
+	if ok, _ := qt.RemoveValue(p, 3); ok {
+		t.Error("RemoveValue removes 3 twice")
+	}
+	if ok, _ := qt.RemoveValue(p, 10); ok {
+		t.Error("RemoveValue removes a value of another key")
+	}
+	if all, _ := qt.GetAll(p); !slices.Equal(all, []int{1, 2, 4}) {
+		t.Fatalf("GetAll returns %v", all)
+	}
+	if qt.Size() != 4 {
+		t.Fatalf("size is %d, want 4", qt.Size())
+	}
+
+	//absent keys
+	if v, ok, _ := qt.PutIfAbsent([]float64{3, 3}, 7); ok || v != 7 {
+		t.Errorf("PutIfAbsent returns %d, %v", v, ok)
+	}
+	if _, ok, _ := qt.Put([]float64{4, 4}, 8); ok {
+		t.Error("Put finds an absent key")
+	}
+	if v, ok, _ := qt.Compute([]float64{5, 5}, func(old int, exists bool) (int, bool) {
+		if exists {
+			t.Error("Compute finds an absent key")
+		}
+		return 9, true
+	}); !ok || v != 9 {
+		t.Errorf("Compute returns %d, %v", v, ok)
+	}
+	if _, ok, _ := qt.Compute([]float64{6, 6}, func(old int, exists bool) (int, bool) {
+		return 0, false
+	}); ok || qt.Contains([]float64{6, 6}) {
+		t.Error("Compute inserts an entry it doesn't keep")
+	}
+	if all, _ := qt.GetAll([]float64{6, 6}); len(all) != 0 {
+		t.Errorf("GetAll returns %v for an absent key", all)
+	}
+	if qt.Size() != 7 {
+		t.Fatalf("size is %d, want 7", qt.Size())
+	}
+	if err := qt.Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRemoveValueComparesDeeply(t *testing.T) {
+	qt := NewQuadTree[any](1, 3)
+	p := []float64{1}
+	qt.Insert(p, []int{1})
+	qt.Insert(p, 5)
+	qt.Insert(p, nil)
+	if ok, _ := qt.RemoveValue(p, 6); ok {
+		t.Error("RemoveValue removes 6")
+	}
+	if ok, _ := qt.RemoveValue(p, nil); !ok {
+		t.Error("RemoveValue doesn't find nil")
+	}
+	if ok, _ := qt.RemoveValue(p, []int{1}); !ok {
+		t.Error("RemoveValue doesn't find []int{1}")
+	}
+	if all, _ := qt.GetAll(p); len(all) != 1 || all[0] != 5 {
+		t.Errorf("GetAll returns %v", all)
+	}
+}
+
+func TestMapPolicy(t *testing.T) {
+	qt := NewQuadTreeWithPolicy[int](2, 2, Map)
+	p, q := []float64{1, 1}, []float64{2, 2}
+	e1, _ := qt.Insert(p, 1)
+	e2, _ := qt.Insert(p, 2)
+	if e1 != e2 || qt.Size() != 1 {
+		t.Fatal("Insert adds a second entry for a key")
+	}
+	if v, _, _ := qt.Get(p); v != 2 {
+		t.Fatalf("Insert doesn't replace the value, got %d", v)
+	}
+	if v, ok, _ := qt.PutIfAbsent(p, 3); !ok || v != 2 {
+		t.Errorf("PutIfAbsent returns %d, %v", v, ok)
+	}
+
+	//Update replaces the entry at the new key
+	qt.Insert(q, 10)
+	if v, ok, _ := qt.Update(p, q); !ok || v != 2 {
+		t.Fatalf("Update returns %d, %v", v, ok)
+	}
+	if all, _ := qt.GetAll(q); !slices.Equal(all, []int{2}) || qt.Contains(p) || qt.Size() != 1 {
+		t.Fatalf("GetAll returns %v after Update", all)
+	}
+	//updating to the same key keeps the entry
+	if _, ok, _ := qt.Update(q, q); !ok || qt.Size() != 1 {
+		t.Fatal("Update to the same key removes the entry")
+	}
+	//a missing entry doesn't remove the one at the new key
+	if _, ok, _ := qt.Update(p, q); ok || !qt.Contains(q) {
+		t.Fatal("Update of a missing entry removes the new key")
+	}
+	if err := qt.Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestMapPolicyModel compares a tree in map mode with a Go map.
+func TestMapPolicyModel(t *testing.T) {
+	r := rand.New(rand.NewSource(3))
+	qt := NewQuadTreeWithPolicy[int](2, 4, Map)
+	model := map[string]int{}
+	point := func() []float64 {
+		return []float64{float64(r.Intn(20)), float64(r.Intn(20))}
+	}
+	for i := 0; i < 20000; i++ {
+		p := point()
+		k := fmt.Sprint(p)
+		old, exists := model[k]
+		switch r.Intn(6) {
+		case 0:
+			qt.Insert(p, i)
+			model[k] = i
+		case 1:
+			v, ok, _ := qt.Put(p, i)
+			if ok != exists || v != old {
+				t.Fatalf("Put returns %d, %v, want %d, %v", v, ok, old, exists)
+			}
+			model[k] = i
+		case 2:
+			v, ok, _ := qt.PutIfAbsent(p, i)
+			if !exists {
+				old = i
+				model[k] = i
+			}
+			if ok != exists || v != old {
+				t.Fatalf("PutIfAbsent returns %d, %v, want %d, %v", v, ok, old, exists)
+			}
+		case 3:
+			//odd values are incremented, even values removed
+			v, ok, _ := qt.Compute(p, func(old int, exists bool) (int, bool) {
+				if !exists {
+					return i, true
+				}
+				return old + 1, old%2 != 0
+			})
+			switch {
+			case !exists:
+				model[k] = i
+			case old%2 == 0:
+				delete(model, k)
+			default:
+				model[k] = old + 1
+			}
+			if want, keep := model[k]; ok != keep || v != want {
+				t.Fatalf("Compute returns %d, %v, want %d, %v", v, ok, want, keep)
+			}
+		case 4:
+			if _, ok, _ := qt.Remove(p); ok != exists {
+				t.Fatalf("Remove returns %v, want %v", ok, exists)
+			}
+			delete(model, k)
+		case 5:
+			q := point()
+			v, ok, _ := qt.Update(p, q)
+			if ok != exists || v != old {
+				t.Fatalf("Update returns %d, %v, want %d, %v", v, ok, old, exists)
+			}
+			if exists {
+				delete(model, k)
+				model[fmt.Sprint(q)] = old
+			}
+		}
+		if qt.Size() != len(model) {
+			t.Fatalf("size is %d, want %d", qt.Size(), len(model))
+		}
+	}
+	for x := 0.0; x < 20; x++ {
+		for y := 0.0; y < 20; y++ {
+			p := []float64{x, y}
+			all, _ := qt.GetAll(p)
+			if v, ok := model[fmt.Sprint(p)]; ok != (len(all) == 1) || ok && all[0] != v {
+				t.Fatalf("GetAll returns %v at %v, want %d", all, p, v)
+			}
+		}
+	}
+	if err := qt.Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -17,9 +17,8 @@
 package qthc
 
 import (
-	"log"
+	"log/slog"
 	"math"
-	"sort"
 )
 
 const (
@@ -27,52 +26,93 @@ const (
 	MAX_DEPTH                 = 50
 )
 
-var (
-	DEBUG = false
-)
-
-type QuadTree struct {
+// QuadTree maps points to values of type V. Whether several entries may
+// share the same point depends on the DuplicatePolicy.
+type QuadTree[V any] struct {
 	dim, maxNodeSize, size int
-	root                   *Node
+	maxDepth               int
+	root                   *Node[V]
+	policy                 DuplicatePolicy
+	metric                 Metric
+	logger                 *slog.Logger
+	keys                   KeyPolicy
+	//optional domain, see NewQuadTreeWithBounds()
+	domainMin, domainMax []float64
+	domainCenter         []float64
+	domainRadius         float64
+	oob                  OutOfBoundsPolicy
+	//automatic compaction, see SetAutoCompact()
+	autoCompact float64
+	removed     int
+	//generation for copy-on-write, 0 if the tree doesn't share nodes
+	gen   uint64
+	codec ValueCodec[V]
+	//see AddAggregator()
+	aggs []aggregator[V]
+	//iteration state, shared with snapshots, see All()
+	pools *seqPools
 }
 
-func NewQuadTree(dim, maxNodeSize int) *QuadTree {
-	if DEBUG {
-		log.Println("Warning: DEBUG enabled")
-		log.Println("Starting QuadTree...")
-	}
-	ans := new(QuadTree)
-	ans.dim = dim
-	ans.maxNodeSize = maxNodeSize
-	return ans
+func NewQuadTree[V any](dim, maxNodeSize int) *QuadTree[V] {
+	return New[V](dim, WithMaxNodeSize(maxNodeSize))
 }
 
-func NewDefaultQuadTree(dim int) *QuadTree {
-	maxNodeSize := DEFAULT_MAX_NODE_SIZE
-	if 2*dim > DEFAULT_MAX_NODE_SIZE {
-		maxNodeSize = 2 * dim
+func NewDefaultQuadTree[V any](dim int) *QuadTree[V] {
+	return New[V](dim)
+}
+
+// Insert adds an entry and returns it as a handle for RemoveEntry() and
+// MoveEntry(). In map mode it replaces the value of an existing entry with
+// the same key, see Put(), and returns that entry. It fails with
+// ErrDimensionMismatch or ErrNonFiniteCoordinate if key is invalid and with
+// ErrOutOfBounds if the tree rejects key.
+func (qt *QuadTree[V]) Insert(key []float64, value V) (*Entry[V], error) {
+	if qt.policy == Map {
+		e, _, _, err := qt.set(key, value)
+		return e, err
 	}
-	return NewQuadTree(dim, maxNodeSize)
+	return qt.insert(key, value)
 }
 
-func (qt *QuadTree) Insert(key []float64, value interface{}) {
+func (qt *QuadTree[V]) insert(key []float64, value V) (*Entry[V], error) {
+	if err := qt.checkKey(key); err != nil {
+		return nil, err
+	}
+	if err := qt.checkBounds(key); err != nil {
+		return nil, err
+	}
 	qt.size++
 	e := NewEntry(key, value)
 	if qt.root == nil {
 		qt.initializeRoot(key)
 	}
+	qt.mutableRoot()
 
 	qt.ensureCoverage(e)
+	qt.put(e, qt.keys == CopyKeys)
+	qt.updateAggregates()
+	return e, nil
+}
 
-	depth := 0
-	r := qt.root
-	for r != nil {
-		r = r.tryPut(e, qt.maxNodeSize, depth > MAX_DEPTH)
-		depth++
-	}
+// put adds e to the tree, the root must already cover it. If storeKey is
+// set, the point of e is copied into the node that receives e.
+func (qt *QuadTree[V]) put(e *Entry[V], storeKey bool) {
+	qt.putFrom(qt.root, 0, e, storeKey)
+}
+
+// putFrom works like put() but starts at node r at the given depth, which
+// must cover e.
+func (qt *QuadTree[V]) putFrom(r *Node[V], depth int, e *Entry[V], storeKey bool) {
+	r.put(e, qt.maxNodeSize, depth, qt.maxDepth, storeKey, qt.nodeEvents())
 }
 
-func (qt *QuadTree) initializeRoot(key []float64) {
+func (qt *QuadTree[V]) initializeRoot(key []float64) {
+	if qt.domainCenter != nil {
+		center := append([]float64(nil), qt.domainCenter...)
+		qt.root = newNode[V](center, qt.domainRadius)
+		qt.root.gen = qt.gen
+		return
+	}
 	lo := math.MaxFloat64
 	hi := -math.MaxFloat64
 	for d := 0; d < qt.dim; d++ {
@@ -100,214 +140,282 @@ func (qt *QuadTree) initializeRoot(key []float64) {
 		}
 	}
 
-	qt.root = newNode(center, maxDistOrigin)
+	qt.root = newNode[V](center, maxDistOrigin)
+	qt.root.gen = qt.gen
 }
 
-func (qt *QuadTree) Contains(key []float64) bool {
-	if qt.root == nil {
+func (qt *QuadTree[V]) mutableRoot() {
+	if qt.root.gen != qt.gen {
+		qt.root = qt.root.copy(qt.gen)
+	}
+}
+
+// Contains returns whether there is an entry with the given key. It is
+// false for invalid keys.
+func (qt *QuadTree[V]) Contains(key []float64) bool {
+	if qt.root == nil || qt.checkKey(key) != nil {
 		return false
 	}
 
 	return qt.root.getExact(key) != nil
 }
 
-func (qt *QuadTree) Get(key []float64) interface{} {
+// Get returns the value stored for key. The boolean is false if there is no
+// such entry. It fails with ErrDimensionMismatch or ErrNonFiniteCoordinate
+// if key is invalid.
+func (qt *QuadTree[V]) Get(key []float64) (V, bool, error) {
+	var zero V
+	if err := qt.checkKey(key); err != nil {
+		return zero, false, err
+	}
 	if qt.root == nil {
-		return nil
+		return zero, false, nil
 	}
 
 	e := qt.root.getExact(key)
 
 	if e == nil {
-		return nil
+		return zero, false, nil
 	}
 
-	return e.value
+	return e.value, true, nil
 }
 
-func (qt *QuadTree) Remove(key []float64) interface{} {
+// Remove removes an entry with the given key and returns its value. The
+// boolean is false if there is no such entry. It fails with
+// ErrDimensionMismatch or ErrNonFiniteCoordinate if key is invalid.
+func (qt *QuadTree[V]) Remove(key []float64) (V, bool, error) {
+	var zero V
+	if err := qt.checkKey(key); err != nil {
+		return zero, false, err
+	}
 	if qt.root == nil {
-		if DEBUG {
-			log.Printf("Remove failure. Root is nil: %v \n", key)
-		}
-
-		return nil
+		return zero, false, nil
 	}
-	e := qt.root.remove(nil, key, qt.maxNodeSize)
+	qt.mutableRoot()
+	e := qt.root.remove(nil, key, nil, qt.maxNodeSize, qt.nodeEvents())
 	if e == nil {
-		if DEBUG {
-			log.Printf("Remove failure. Not in root: %v \n", key)
+		if qt.logs(slog.LevelDebug) {
+			qt.log(slog.LevelDebug, "remove failure, entry not found", slog.Any("key", key))
 		}
-		return nil
+		return zero, false, nil
 	}
 
 	qt.size--
-	return e.value
+	qt.afterRemove(1)
+	return e.value, true, nil
 }
 
-func (qt *QuadTree) Update(oldKey, newKey []float64) interface{} {
+// Update moves an entry from oldKey to newKey and returns its value. The
+// boolean is false if there is no entry at oldKey. In map mode an entry that
+// already exists at newKey is replaced. It fails if a key is invalid or if
+// the tree rejects newKey (ErrOutOfBounds), the entry then stays at oldKey.
+func (qt *QuadTree[V]) Update(oldKey, newKey []float64) (V, bool, error) {
+	var zero V
+	if err := qt.checkKey(oldKey); err != nil {
+		return zero, false, err
+	}
+	if err := qt.checkKey(newKey); err != nil {
+		return zero, false, err
+	}
+	if err := qt.checkBounds(newKey); err != nil {
+		return zero, false, err
+	}
 	if qt.root == nil {
-		return nil
+		return zero, false, nil
+	}
+	if qt.policy == Map && !isPointEqual(oldKey, newKey) && qt.Contains(oldKey) {
+		qt.Remove(newKey)
 	}
+	qt.mutableRoot()
 	requiresReinsert := []bool{false}
-	e := qt.root.update(nil, oldKey, newKey, qt.maxNodeSize, requiresReinsert, 0, MAX_DEPTH)
+	storeKey := qt.keys == CopyKeys
+	e := qt.root.update(nil, oldKey, newKey, qt.maxNodeSize, requiresReinsert, 0, qt.maxDepth, storeKey, qt.nodeEvents())
 	if e == nil {
-		//not found
-		if DEBUG {
-			log.Printf("Reinsert failure: %v \n", newKey)
+		if qt.logs(slog.LevelDebug) {
+			qt.log(slog.LevelDebug, "update failure, entry not found", slog.Any("key", oldKey))
 		}
-		return nil
+		return zero, false, nil
 	}
 	if requiresReinsert[0] {
-		if DEBUG {
-			log.Printf("Reinsert failure: %v \n", newKey)
+		if qt.logs(slog.LevelDebug) {
+			qt.log(slog.LevelDebug, "reinsert failure, key is outside of root",
+				slog.Any("key", newKey),
+				slog.Any("center", qt.root.center),
+				slog.Float64("radius", qt.root.radius))
 		}
 		//does not fit in root node...
 		qt.ensureCoverage(e)
-		depth := 0
-		r := qt.root
-
-		for r != nil {
-			r = r.tryPut(e, qt.maxNodeSize, depth > MAX_DEPTH)
-			depth++
-		}
+		qt.put(e, storeKey)
 	}
 
-	return e.value
+	qt.afterRemove(1)
+	return e.value, true, nil
 }
 
-func (qt *QuadTree) ensureCoverage(e *Entry) {
+func (qt *QuadTree[V]) ensureCoverage(e *Entry[V]) {
 	p := e.point
 
 	for !e.enclosedFromCenter(qt.root.center, qt.root.radius) {
 		center := qt.root.center
 		radius := qt.root.radius
-		center2 := make([]float64, len(center))
-		radius2 := radius * 2
-		subNodePos := 0
-		for d := 0; d < len(center); d++ {
-			subNodePos <<= 1
-			if p[d] < center[d]-radius {
-				center2[d] = center[d] - radius
-				//root will end up in upper quadrant in this
-				//dimension
-				subNodePos |= 1
-			} else {
-				//extend upwards, even if extension unnecessary for this dimension.
-				center2[d] = center[d] + radius
-			}
+		var buf [hcInlineWords]uint64
+		center2, radius2, subNodePos := growBox(center, radius, p, buf[:])
+
+		if qt.logs(slog.LevelDebug) {
+			qt.log(slog.LevelDebug, "root grown",
+				slog.Any("key", e.point),
+				slog.Any("center", center2),
+				slog.Float64("radius", radius2))
 		}
 
-		if DEBUG && !isRectEnclosed(center, radius, center2, radius2) {
-			log.Printf("entry at %.4f: center/radius at %.4f/%.4f \n", e.point, center2, radius)
+		moved := qt.takeUpperBoundary(subNodePos)
+		qt.root = newNodeWithSub(center2, radius2, qt.root, subNodePos)
+		qt.root.gen = qt.gen
+		for _, e2 := range moved {
+			qt.put(e2, false)
 		}
+	}
+}
 
-		qt.root = newNodeWithSub(center2, radius2, qt.root, subNodePos)
+// takeUpperBoundary removes the entries that lie on the upper boundary of
+// the root in a dimension where the root becomes the lower quadrant of a new
+// root. Such points belong to the upper quadrant of the new root and
+// wouldn't be found in the old root.
+func (qt *QuadTree[V]) takeUpperBoundary(subNodePos hcPos) []*Entry[V] {
+	root := qt.root
+	var moved []*Entry[V]
+	for d := 0; d < qt.dim; d++ {
+		if subNodePos.isSet(qt.dim, d) {
+			continue
+		}
+		min := make([]float64, qt.dim)
+		max := make([]float64, qt.dim)
+		for d2 := 0; d2 < qt.dim; d2++ {
+			min[d2] = root.center[d2] - root.radius
+			max[d2] = root.center[d2] + root.radius
+		}
+		min[d] = max[d]
+		it := newIterator(qt, min, max)
+		for it.HasNext() {
+			moved = append(moved, it.Next())
+		}
+	}
+
+	n := 0
+	for _, e := range moved {
+		//points on several boundaries are found more than once
+		if root.remove(nil, e.point, func(e2 *Entry[V]) bool { return e2 == e }, qt.maxNodeSize, qt.nodeEvents()) != nil {
+			moved[n] = e
+			n++
+		}
 	}
+	return moved[:n]
 }
 
-func (qt *QuadTree) Clear() {
-	qt.size = 0
-	qt.root = nil
+// growBox doubles the box given by center/radius towards p. It returns the
+// new box and the position of the old box in the new one.
+func growBox(center []float64, radius float64, p []float64, buf []uint64) ([]float64, float64, hcPos) {
+	center2 := make([]float64, len(center))
+	radius2 := radius * 2
+	subNodePos := hcMake(len(center), buf)
+	for d := 0; d < len(center); d++ {
+		if p[d] < center[d]-radius {
+			center2[d] = center[d] - radius
+			//root will end up in upper quadrant in this
+			//dimension
+			subNodePos.set(len(center), d)
+		} else {
+			//extend upwards, even if extension unnecessary for this dimension.
+			center2[d] = center[d] + radius
+		}
+	}
+	return center2, radius2, subNodePos
 }
 
-func (qt *QuadTree) SearchIntersect(min, max []float64) QueryIterator {
-	return newIterator(qt, min, max)
+func (qt *QuadTree[V]) Size() int {
+	return qt.size
 }
 
-func (qt *QuadTree) NearestNeighbor(center []float64, k int) []*EntryDist {
-	if qt.root == nil {
-		return []*EntryDist{}
-	}
+// cowCopy returns a tree that shares all nodes with qt. Both trees must only
+// be modified through copy-on-write, see Node.mutableSub().
+func (qt *QuadTree[V]) cowCopy() *QuadTree[V] {
+	ans := new(QuadTree[V])
+	*ans = *qt
+	ans.gen = lastGen.Add(1)
+	return ans
+}
 
-	candidates := make([]*EntryDist, 0)
-	rangeSearchKNN(qt.root, center, candidates, k, math.MaxFloat64)
-	return candidates
+func (qt *QuadTree[V]) Clear() {
+	qt.size = 0
+	qt.root = nil
 }
 
-func rangeSearchKNN(node *Node, center []float64, candidates []*EntryDist, k int, maxRange float64) float64 {
-	posHC := node.calcSubPosition(center)
-	entries := node.entries()
-	var alreadyVisited interface{}
-	if !node.isLeaf {
-		//Search best node first
-		ePos := entries[posHC]
-		if v, ok := ePos.(*Node); ok {
-			maxRange = rangeSearchKNN(v, center, candidates, k, maxRange)
-			alreadyVisited = ePos
-		}
+// SearchIntersect returns all entries inside the window min/max. If the
+// window is invalid the iterator is empty and its Err() reports why.
+func (qt *QuadTree[V]) SearchIntersect(min, max []float64) QueryIterator[V] {
+	return newIterator(qt, min, max)
+}
+
+// Count returns the number of entries inside the window min/max, the same
+// entries that SearchIntersect() returns. Sub trees that are completely
+// inside the window contribute their cached entry count, only nodes on the
+// border of the window are scanned. Count returns 0 for an invalid window.
+func (qt *QuadTree[V]) Count(min, max []float64) int {
+	if qt.root == nil || qt.checkWindow(min, max) != nil {
+		return 0
 	}
-	//TODO first sort entries by distance!
-	//TODO reuse buffer!
-	buffer := make([]*KnnTemp, 0)
-	for i := 0; i < len(entries); i++ {
-		e := entries[i]
-		if v, ok := e.(*Node); ok && e != alreadyVisited {
-			n := v
-			dist := distToRectNode(center, n.center, n.radius)
-			addToBuffer(n, dist, maxRange, buffer)
-		} else if v2, ok2 := e.(*Entry); ok2 {
-			p := v2
-			dist := distance(center, p.point)
-			addToBuffer(p, dist, maxRange, buffer)
-		}
+	if qt.root.isInside(min, max) {
+		return qt.root.numEntries()
 	}
-	sort.Sort(byDistKnn(buffer))
-
-	for i := 0; i < len(buffer); i++ {
-		t := buffer[i]
-		if t.dist > maxRange {
-			//check again, because maxDist may change during this loop
+	n := 0
+	stack := qt.getStack()
+	defer qt.putStack(stack)
+	stack.prepareAndPush(qt.root, min, max)
+	for !stack.isEmpty() {
+		sub, ok := stack.peek().nextSlot()
+		if !ok {
+			stack.pop()
 			continue
 		}
-		o := t.o
-		if v, ok := o.(*Node); ok && o != alreadyVisited {
-			maxRange = rangeSearchKNN(v, center, candidates, k, maxRange)
-		} else if v2, ok2 := o.(*Entry); ok2 {
-			p := v2
-			candidates = append(candidates, NewEntryDist(p, t.dist))
-			maxRange = adjustRegionKNN(candidates, k, maxRange)
+		if v := sub.node; v != nil {
+			if v.isInside(min, max) {
+				n += v.numEntries()
+			} else {
+				stack.prepareAndPush(v, min, max)
+			}
+		} else if v := sub.entry; v != nil {
+			if v.enclosed(min, max) {
+				n++
+			}
 		}
 	}
-	return maxRange
+	return n
 }
 
-func addToBuffer(o interface{}, dist, maxDist float64, buffer []*KnnTemp) {
-	if dist < maxDist {
-		buffer = append(buffer, newKnnTemp(o, dist))
-	}
+// SearchRadius returns all entries whose distance to center is at most
+// radius. A nil metric means the metric of the tree, see WithMetric(). An
+// invalid center yields an empty iterator whose Err() returns the error.
+func (qt *QuadTree[V]) SearchRadius(center []float64, radius float64, m Metric) RadiusIterator[V] {
+	return newRadiusIterator(qt, center, radius, qt.metricOrDefault(m))
 }
 
-func adjustRegionKNN(candidates []*EntryDist, k int, maxRange float64) float64 {
-	if len(candidates) < k {
-		//wait for more candidates
-		return maxRange
-	}
-
-	//use stored distances instead of recalculating them
-	sort.Sort(byDistEntry(candidates))
-
-	for len(candidates) > k && len(candidates) > 0 {
-		candidates = candidates[:len(candidates)-1]
-	}
-
-	return candidates[len(candidates)-1].dist
+// SearchNearest returns an iterator over all entries ordered by their
+// distance to center. A nil metric means the metric of the tree. An invalid
+// center yields an empty iterator whose Err() returns the error.
+func (qt *QuadTree[V]) SearchNearest(center []float64, m Metric) NearestIterator[V] {
+	return newNearestIterator(qt, center, qt.metricOrDefault(m))
 }
 
-type KnnTemp struct {
-	o    interface{}
-	dist float64
-}
+// NearestNeighbor returns the k entries closest to center, sorted by
+// distance. A nil metric means the metric of the tree. The result is empty
+// if center is invalid.
+func (qt *QuadTree[V]) NearestNeighbor(center []float64, k int, m Metric) []*EntryDist[V] {
+	if qt.root == nil || k <= 0 || qt.checkKey(center) != nil {
+		return []*EntryDist[V]{}
+	}
 
-func newKnnTemp(o interface{}, d float64) *KnnTemp {
-	ans := new(KnnTemp)
-	ans.o = o
-	ans.dist = d
-	return ans
+	s := newKnnSearch[V](center, k, qt.metricOrDefault(m))
+	s.search(qt.root)
+	return s.result()
 }
-
-type byDistKnn []*KnnTemp
-
-func (a byDistKnn) Len() int           { return len(a) }
-func (a byDistKnn) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
-func (a byDistKnn) Less(i, j int) bool { return a[i].dist < a[j].dist }
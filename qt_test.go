@@ -0,0 +1,140 @@
+package qthc
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestUpdateMissingKeyInDirectoryNode(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	qt := NewQuadTree[int](2, 2)
+	for i := 0; i < 100; i++ {
+		qt.Insert([]float64{float64(r.Intn(16)), float64(r.Intn(16))}, i)
+	}
+	//keys between the grid points are missing, their quadrant in a
+	//directory node may hold another entry
+	for i := 0; i < 100; i++ {
+		key := []float64{float64(r.Intn(16)) + 0.5, float64(r.Intn(16)) + 0.5}
+		qt.Update(key, []float64{0, 0})
+	}
+	if qt.Size() != 100 || qt.Contains([]float64{0.5, 0.5}) {
+		t.Fatal("update of a missing key changed the tree")
+	}
+}
+
+func TestGrowKeepsPointsOnUpperBoundary(t *testing.T) {
+	qt := NewQuadTree[int](2, 10)
+	//the root covers [0, 4] in both dimensions
+	qt.Insert([]float64{2, 2}, 1)
+	qt.Insert([]float64{4, 4}, 2)
+	//the root grows upwards, (4, 4) becomes the center of the new root
+	qt.Insert([]float64{9, 1}, 3)
+	for _, p := range [][]float64{{2, 2}, {4, 4}, {9, 1}} {
+		if !qt.Contains(p) {
+			t.Fatalf("%v is lost", p)
+		}
+	}
+}
+
+func TestCountMatchesSearchIntersect(t *testing.T) {
+	for _, dim := range []int{1, 2, 3, 12} {
+		for _, bounded := range []bool{false, true} {
+			r := rand.New(rand.NewSource(int64(dim)))
+			opts := []Option{WithMaxNodeSize(4)}
+			if bounded {
+				min, max := make([]float64, dim), make([]float64, dim)
+				for d := range max {
+					max[d] = 16
+				}
+				opts = append(opts, WithBounds(min, max, Reject))
+			}
+			qt := New[int](dim, opts...)
+			//points and windows on a grid, windows often match node boxes
+			//exactly and contain entries on their border
+			point := func(scale float64) []float64 {
+				p := make([]float64, dim)
+				for d := range p {
+					p[d] = float64(r.Intn(int(16/scale)+1)) * scale
+				}
+				return p
+			}
+			check := func(phase string) {
+				t.Helper()
+				if err := qt.Validate(); err != nil {
+					t.Fatal(err)
+				}
+				for i := 0; i < 50; i++ {
+					min, max := point(4), point(4)
+					if i == 0 {
+						for d := range min {
+							min[d], max[d] = -100, 100
+						}
+					}
+					for d := range min {
+						if min[d] > max[d] {
+							min[d], max[d] = max[d], min[d]
+						}
+					}
+					n := 0
+					for it := qt.SearchIntersect(min, max); it.HasNext(); it.Next() {
+						n++
+					}
+					if c := qt.Count(min, max); c != n {
+						t.Fatalf("%d dimensions, %s: Count(%v, %v) is %d, SearchIntersect finds %d",
+							dim, phase, min, max, c, n)
+					}
+				}
+			}
+
+			var entries []*Entry[int]
+			for i := 0; i < 2000; i++ {
+				e, _ := qt.Insert(point(0.5), i)
+				entries = append(entries, e)
+			}
+			check("insert")
+			for _, e := range entries[:1000] {
+				qt.RemoveEntry(e)
+			}
+			check("remove")
+			for _, e := range entries[1000:1500] {
+				qt.Update(e.Point(), point(0.5))
+			}
+			for _, e := range entries[1500:] {
+				qt.MoveEntry(e, point(0.5))
+			}
+			check("update")
+			for i := 0; i < 20; i++ {
+				min, max := point(4), point(4)
+				for d := range min {
+					min[d], max[d] = math.Min(min[d], max[d]), math.Max(min[d], max[d])
+				}
+				qt.RemoveIf(min, max, func(e *Entry[int]) bool { return e.Value()%3 != 0 })
+			}
+			check("remove range")
+		}
+	}
+}
+
+func TestCountOfZeroValueTree(t *testing.T) {
+	src := serialTree(2)
+	data, _ := src.MarshalBinary()
+	var qt QuadTree[int]
+	if err := qt.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	sum := AddAggregator(&qt, valueSum)
+	for _, w := range [][2][]float64{{{0, 0}, {10, 10}}, {{-1, -1}, {100, 100}}, {{3.5, 2}, {4, 30}}} {
+		want, total := 0, 0
+		for it := src.SearchIntersect(w[0], w[1]); it.HasNext(); {
+			want++
+			total += it.Next().Value()
+		}
+		if n := qt.Count(w[0], w[1]); n != want {
+			t.Errorf("Count(%v, %v) is %d, want %d", w[0], w[1], n, want)
+		}
+		if s := sum.Aggregate(w[0], w[1]); s != total {
+			t.Errorf("Aggregate(%v, %v) is %d, want %d", w[0], w[1], s, total)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package qthc
+
+import (
+	"math"
+)
+
+// RadiusIterator returns all entries within a given distance of a center
+// point.
+type RadiusIterator[V any] interface {
+	HasNext() bool
+	Next() *Entry[V]
+	Reset(center []float64, radius float64)
+	// Err returns the error that prevented the last query from running,
+	// for example ErrDimensionMismatch for an invalid center.
+	Err() error
+}
+
+// radiusIterator runs a window query over the bounding box of the
+// hypersphere. Nodes that are further away than the radius are pruned and
+// entries are filtered with the exact distance.
+type radiusIterator[V any] struct {
+	it       *iterator[V]
+	min, max []float64
+}
+
+func newRadiusIterator[V any](tree *QuadTree[V], center []float64, radius float64, m Metric) *radiusIterator[V] {
+	ans := new(radiusIterator[V])
+	ans.it = new(iterator[V])
+	ans.it.stack = newIteratorStack[V]()
+	ans.it.tree = tree
+	ans.it.metric = m
+	ans.min = make([]float64, tree.dim)
+	ans.max = make([]float64, tree.dim)
+	ans.Reset(center, radius)
+
+	return ans
+}
+
+func (r *radiusIterator[V]) HasNext() bool {
+	return r.it.HasNext()
+}
+
+func (r *radiusIterator[V]) Next() *Entry[V] {
+	return r.it.Next()
+}
+
+/**
+ * Reset the iterator. This iterator can be reused in order to reduce load on the
+ * garbage collector.
+ */
+func (r *radiusIterator[V]) Reset(center []float64, radius float64) {
+	if err := r.it.tree.checkKey(center); err != nil {
+		r.it.stack.clear()
+		r.it.center = nil
+		r.it.next = nil
+		r.it.err = err
+		return
+	}
+	if bm, ok := r.it.metric.(BoundedMetric); ok {
+		bm.Bounds(center, radius, r.min, r.max)
+	} else {
+		for d := 0; d < len(r.min); d++ {
+			r.min[d] = math.Inf(-1)
+			r.max[d] = math.Inf(1)
+		}
+	}
+	r.it.center = center
+	r.it.radius = radius
+	r.it.Reset(r.min, r.max)
+}
+
+func (r *radiusIterator[V]) Err() error {
+	return r.it.err
+}
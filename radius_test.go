@@ -0,0 +1,30 @@
+package qthc
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestSearchRadiusIncludesBoundary(t *testing.T) {
+	r := rand.New(rand.NewSource(5))
+	qt := NewQuadTree[int](3, 4)
+	for i := 0; i < 2000; i++ {
+		qt.Insert(randomPoint(r, 3), i)
+	}
+	for _, m := range shippedMetrics() {
+		for q := 0; q < 200; q++ {
+			c := randomPoint(r, 3)
+			//the radius is the exact distance of the 10th entry
+			radius := qt.NearestNeighbor(c, 10, m)[9].Dist()
+			n := 0
+			for it := qt.SearchRadius(c, radius, m); it.HasNext(); n++ {
+				if e := it.Next(); m.Distance(c, e.point) > radius {
+					t.Fatalf("%T: %v is further than %v", m, e.point, radius)
+				}
+			}
+			if n < 10 {
+				t.Fatalf("%T: %d entries within %v of %v, want at least 10", m, n, radius, c)
+			}
+		}
+	}
+}
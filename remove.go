@@ -0,0 +1,98 @@
+package qthc
+
+// RemoveRange removes all entries inside the window min/max and returns how
+// many were removed. Sub trees that are completely inside the window are
+// removed without visiting their entries. RemoveRange returns 0 for an
+// invalid window.
+func (qt *QuadTree[V]) RemoveRange(min, max []float64) int {
+	return qt.RemoveIf(min, max, nil)
+}
+
+// RemoveIf removes the entries inside the window min/max for which pred
+// returns true and returns how many were removed. A nil pred removes all
+// entries in the window, see RemoveRange(). Nodes are merged once per
+// visited node instead of once per removed entry. pred must not modify the
+// tree.
+func (qt *QuadTree[V]) RemoveIf(min, max []float64, pred func(e *Entry[V]) bool) int {
+	if qt.root == nil || qt.checkWindow(min, max) != nil || !qt.root.intersects(min, max) {
+		return 0
+	}
+	qt.mutableRoot()
+	n := qt.root.removeIf(min, max, pred, qt.maxNodeSize, qt.nodeEvents())
+	if n == 0 {
+		qt.updateAggregates()
+		return 0
+	}
+	qt.size -= n
+	qt.afterRemove(n)
+	return n
+}
+
+// removeIf removes the matching entries from the sub tree of n, which must
+// belong to the current generation, and returns how many were removed.
+// Afterwards n merges its sub nodes if possible.
+func (n *Node[V]) removeIf(min, max []float64, pred func(e *Entry[V]) bool, maxNodeSize int, ev nodeEvent[V]) int {
+	if n.isLeaf {
+		j := 0
+		for i := 0; i < n.nValues; i++ {
+			e := n.values[i]
+			if e.enclosed(min, max) && (pred == nil || pred(e)) {
+				if n.gen == 0 {
+					e.node = nil
+				}
+				continue
+			}
+			n.values[j] = e
+			j++
+		}
+		count := n.nValues - j
+		for i := j; i < n.nValues; i++ {
+			n.values[i] = nil
+		}
+		n.nValues = j
+		if count > 0 {
+			n.dirty = true
+		}
+		return count
+	}
+
+	count := 0
+	for _, s := range n.occupiedSlots() {
+		if v := s.sub.node; v != nil {
+			if !v.intersects(min, max) {
+				continue
+			}
+			c := 0
+			if pred == nil && v.isInside(min, max) {
+				c = v.numEntries()
+				if v.gen == 0 {
+					//entries of the sub tree no longer reach the root
+					v.parent = nil
+				}
+				n.setSub(s.pos, child[V]{})
+			} else {
+				sub := n.mutableSub(s.pos, v)
+				c = sub.removeIf(min, max, pred, maxNodeSize, ev)
+				if sub.numEntries() == 0 {
+					n.setSub(s.pos, child[V]{})
+				} else if sub.dirty {
+					//copies of sub nodes mark their parent even if nothing
+					//was removed
+					n.dirty = true
+				}
+			}
+			n.nEntries -= c
+			count += c
+		} else if v := s.sub.entry; v != nil {
+			if v.enclosed(min, max) && (pred == nil || pred(v)) {
+				n.removeSubEntry(s.pos)
+				count++
+			}
+		}
+	}
+	if count > 0 {
+		n.dirty = true
+		n.checkAndMergeLeafNodes(maxNodeSize, ev)
+	}
+	return count
+}
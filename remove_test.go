@@ -0,0 +1,27 @@
+package qthc
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestRemoveIfMatchingNothingKeepsTreeValid(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	base := NewQuadTree[int](2, 4)
+	AddAggregator(base, Monoid[int, int]{0, func(e *Entry[int]) int { return e.value }, func(a, b int) int { return a + b }})
+	for i := 0; i < 200; i++ {
+		base.Insert([]float64{r.Float64(), r.Float64()}, i)
+	}
+	base.updateAggregates()
+	//the copy shares all nodes with base, Insert() copies the path to the
+	//new entry and updating the aggregates leaves these copies unchanged
+	qt := base.cowCopy()
+	qt.Insert([]float64{0.01, 0.01}, 200)
+	qt.updateAggregates()
+	if n := qt.RemoveIf([]float64{0, 0}, []float64{0.3, 0.3}, func(e *Entry[int]) bool { return false }); n != 0 {
+		t.Fatalf("removed %d entries, want 0", n)
+	}
+	if err := qt.Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,123 @@
+package qthc
+
+import (
+	"iter"
+	"math"
+	"sync"
+)
+
+// seqPools holds iteration state for reuse by later iterations. Values are
+// *IteratorStack[V] and *nearestIterator[V] of the tree's V. A tree that
+// isn't created by New() has no pools, its iterations allocate their state.
+type seqPools struct {
+	stacks, nearest sync.Pool
+}
+
+func (qt *QuadTree[V]) getStack() *IteratorStack[V] {
+	if qt.pools == nil {
+		return newIteratorStack[V]()
+	}
+	if s, ok := qt.pools.stacks.Get().(*IteratorStack[V]); ok {
+		return s
+	}
+	return newIteratorStack[V]()
+}
+
+// putStack returns a stack to the pool without keeping nodes alive.
+func (qt *QuadTree[V]) putStack(s *IteratorStack[V]) {
+	for _, se := range s.stack {
+		se.node = nil
+	}
+	s.clear()
+	if qt.pools != nil {
+		qt.pools.stacks.Put(s)
+	}
+}
+
+// All returns a sequence of the keys and values of all entries. Keys are
+// copies, like Entry.Point(), Intersect() reads the entries without
+// allocating. The tree must not be modified during the iteration.
+func (qt *QuadTree[V]) All() iter.Seq2[[]float64, V] {
+	return func(yield func([]float64, V) bool) {
+		min := make([]float64, qt.dim)
+		max := make([]float64, qt.dim)
+		for d := range min {
+			min[d], max[d] = math.Inf(-1), math.Inf(1)
+		}
+		qt.intersect(min, max)(func(e *Entry[V]) bool {
+			return yield(e.Point(), e.value)
+		})
+	}
+}
+
+// Intersect returns a sequence of the entries inside the window min/max,
+// the same entries that SearchIntersect() returns. The sequence is empty if
+// the window is invalid. The tree must not be modified during the
+// iteration. Leaving the loop early returns the iteration state to a pool.
+func (qt *QuadTree[V]) Intersect(min, max []float64) iter.Seq[*Entry[V]] {
+	if qt.checkWindow(min, max) != nil {
+		return func(yield func(*Entry[V]) bool) {}
+	}
+	return qt.intersect(min, max)
+}
+
+func (qt *QuadTree[V]) intersect(min, max []float64) iter.Seq[*Entry[V]] {
+	return func(yield func(*Entry[V]) bool) {
+		if qt.root == nil {
+			return
+		}
+		stack := qt.getStack()
+		defer qt.putStack(stack)
+		stack.prepareAndPush(qt.root, min, max)
+		for !stack.isEmpty() {
+			sub, ok := stack.peek().nextSlot()
+			if !ok {
+				stack.pop()
+				continue
+			}
+			if v := sub.node; v != nil {
+				stack.prepareAndPush(v, min, max)
+			} else if v := sub.entry; v != nil {
+				if v.enclosed(min, max) && !yield(v) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Nearest returns a sequence of all entries and their distances to center
+// in order of increasing distance, see SearchNearest(). It uses the metric
+// of the tree. The sequence is empty if center is invalid. The tree must
+// not be modified during the iteration.
+func (qt *QuadTree[V]) Nearest(center []float64) iter.Seq2[*Entry[V], float64] {
+	return func(yield func(*Entry[V], float64) bool) {
+		if qt.root == nil || qt.checkKey(center) != nil {
+			return
+		}
+		var it *nearestIterator[V]
+		if qt.pools != nil {
+			it, _ = qt.pools.nearest.Get().(*nearestIterator[V])
+		}
+		if it == nil {
+			it = new(nearestIterator[V])
+		}
+		//snapshots share the pool
+		it.tree = qt
+		it.metric = qt.metricOrDefault(nil)
+		it.start(center)
+		defer func() {
+			it.clear()
+			it.tree = nil
+			if qt.pools != nil {
+				qt.pools.nearest.Put(it)
+			}
+		}()
+		for {
+			e, dist, ok := it.nextEntry()
+			if !ok || !yield(e, dist) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package qthc
+
+import "testing"
+
+func TestAllYieldsCopiesOfKeys(t *testing.T) {
+	qt := NewQuadTree[int](2, 4)
+	for i := 0; i < 20; i++ {
+		qt.Insert([]float64{float64(i), float64(i % 4)}, i)
+	}
+	n := 0
+	for k := range qt.All() {
+		k[0] = -1
+		n++
+	}
+	if n != 20 {
+		t.Fatalf("All() yielded %d keys, want 20", n)
+	}
+	for i := 0; i < 20; i++ {
+		if !qt.Contains([]float64{float64(i), float64(i % 4)}) {
+			t.Fatalf("key %d changed", i)
+		}
+	}
+	if err := qt.Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSequencesOfZeroValueTree(t *testing.T) {
+	src := serialTree(2)
+	data, _ := src.MarshalBinary()
+	var qt QuadTree[int]
+	if err := qt.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for range qt.All() {
+		n++
+	}
+	if n != src.Size() {
+		t.Errorf("All() yields %d entries, want %d", n, src.Size())
+	}
+	n = 0
+	for range qt.Intersect([]float64{0, 0}, []float64{10, 10}) {
+		n++
+	}
+	if want := src.Count([]float64{0, 0}, []float64{10, 10}); n != want {
+		t.Errorf("Intersect() yields %d entries, want %d", n, want)
+	}
+	center := []float64{5.5, 5.5}
+	want := src.NearestNeighbor(center, 5, nil)
+	n = 0
+	for e, dist := range qt.Nearest(center) {
+		if n == len(want) {
+			break
+		}
+		if dist != want[n].Dist() {
+			t.Errorf("neighbor %d has distance %v, want %v", n, dist, want[n].Dist())
+		}
+		if e == nil {
+			t.Fatal("Nearest() yields nil")
+		}
+		n++
+	}
+	if n != len(want) {
+		t.Errorf("Nearest() yields %d entries, want %d", n, len(want))
+	}
+}
@@ -0,0 +1,501 @@
+package qthc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"math"
+)
+
+// Serialized trees start with a header:
+//
+//	magic "QTHC", version uint16, dim uint32, maxNodeSize uint32, size uint64,
+//	hasRoot uint8
+//
+// followed by the nodes in pre-order and a CRC-32 (IEEE) of all preceding
+// bytes. All numbers are little endian. A node is written as
+//
+//	center [dim]float64, radius float64, isLeaf uint8, then
+//	leaf:      nValues uint32, nValues * entry
+//	directory: nSubs uint32, nSubs * (hcPos [words]uint64, kind uint8, entry or node)
+//
+// and an entry as point [dim]float64, len uint32, value [len]byte.
+const (
+	serialMagic   = "QTHC"
+	serialVersion = 1
+
+	serialEntry = 0
+	serialNode  = 1
+
+	//upper bound for lengths read from a stream, protects against huge
+	//allocations when reading corrupt data
+	maxSerialLen = 1 << 30
+)
+
+var ErrCorruptData = errors.New("qthc: corrupt serialized tree")
+
+// SetValueCodec sets the codec used for values by WriteTo() and ReadFrom().
+// The default is GobCodec.
+func (qt *QuadTree[V]) SetValueCodec(c ValueCodec[V]) {
+	qt.codec = c
+}
+
+func (qt *QuadTree[V]) valueCodec() ValueCodec[V] {
+	if qt.codec == nil {
+		return GobCodec[V]{}
+	}
+	return qt.codec
+}
+
+func (qt *QuadTree[V]) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := qt.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (qt *QuadTree[V]) UnmarshalBinary(data []byte) error {
+	r := bytes.NewReader(data)
+	sr, err := qt.read(r)
+	if err != nil {
+		return err
+	}
+	if r.Len() != 0 {
+		return fmt.Errorf("%w: %d trailing bytes", ErrCorruptData, r.Len())
+	}
+	sr.install(qt)
+	return nil
+}
+
+// WriteTo writes the tree, including its exact node structure, to w.
+func (qt *QuadTree[V]) WriteTo(w io.Writer) (int64, error) {
+	sw := new(serialWriter[V])
+	sw.codec = qt.valueCodec()
+	sw.dim = qt.dim
+	sw.crc = crc32.NewIEEE()
+	sw.w = bufio.NewWriter(io.MultiWriter(&countingWriter{w: w, n: &sw.n}, sw.crc))
+
+	sw.writeBytes([]byte(serialMagic))
+	sw.writeUint16(serialVersion)
+	sw.writeUint32(uint32(qt.dim))
+	sw.writeUint32(uint32(qt.maxNodeSize))
+	sw.writeUint64(uint64(qt.size))
+	if qt.root == nil {
+		sw.writeUint8(0)
+	} else {
+		sw.writeUint8(1)
+		sw.writeNode(qt.root)
+	}
+	if sw.err == nil {
+		sw.err = sw.w.Flush()
+	}
+	if sw.err == nil {
+		//the checksum itself is not part of the checksum
+		var b [4]byte
+		binary.LittleEndian.PutUint32(b[:], sw.crc.Sum32())
+		var n int
+		n, sw.err = w.Write(b[:])
+		sw.n += int64(n)
+	}
+	return sw.n, sw.err
+}
+
+// ReadFrom replaces the content of the tree with a tree read from r. The
+// tree takes dimensionality and node size from the stream, but keeps its
+// duplicate policy and bounds. A map fails to read a stream with duplicate
+// keys, a tree that rejects points outside its bounds fails with
+// ErrOutOfBounds. If the root of the stream doesn't fit the bounds of the
+// tree, the entries are inserted again under the root of the domain.
+// Streams with a broken tree structure fail with ErrCorruptData. If an
+// error occurs, the tree remains unchanged.
+func (qt *QuadTree[V]) ReadFrom(r io.Reader) (int64, error) {
+	sr, err := qt.read(r)
+	if err != nil {
+		return sr.n, err
+	}
+	sr.install(qt)
+	return sr.n, nil
+}
+
+// read reads a tree from r without changing qt, see install().
+func (qt *QuadTree[V]) read(r io.Reader) (*serialReader[V], error) {
+	sr := new(serialReader[V])
+	sr.codec = qt.valueCodec()
+	sr.crc = crc32.NewIEEE()
+	sr.r = io.TeeReader(r, sr.crc)
+	sr.gen = qt.gen
+	sr.unique = qt.policy == Map
+	sr.checkBounds = qt.checkBounds
+
+	magic := sr.readBytes(len(serialMagic))
+	if sr.err == nil && string(magic) != serialMagic {
+		sr.fail("bad magic")
+	}
+	if v := sr.readUint16(); sr.err == nil && v != serialVersion {
+		sr.fail(fmt.Sprintf("unsupported version %d", v))
+	}
+	dim := int(sr.readUint32())
+	maxNodeSize := int(sr.readUint32())
+	size := sr.readUint64()
+	if sr.err == nil && (dim <= 0 || dim > maxSerialLen || maxNodeSize < 1 || size > maxSerialLen*maxSerialLen) {
+		sr.fail("bad header")
+	}
+	if sr.err == nil && qt.domainMin != nil && dim != len(qt.domainMin) {
+		sr.err = fmt.Errorf("qthc: stream has %d dimensions but the tree has bounds for %d", dim, len(qt.domainMin))
+	}
+	sr.dim = dim
+	sr.maxNodeSize = maxNodeSize
+	sr.size = int(size)
+	if sr.readUint8() == 1 && sr.err == nil {
+		sr.root = sr.readNode()
+	}
+	if sr.err == nil && sr.nEntries != size {
+		sr.fail(fmt.Sprintf("size %d does not match %d entries", size, sr.nEntries))
+	}
+	if sr.err == nil {
+		sum := sr.crc.Sum32()
+		var b [4]byte
+		_, sr.err = io.ReadFull(r, b[:])
+		sr.n += int64(len(b))
+		if sr.err == nil && binary.LittleEndian.Uint32(b[:]) != sum {
+			sr.fail("checksum mismatch")
+		}
+	}
+	if sr.err == nil && sr.root != nil {
+		//the checksum doesn't protect against streams that were written
+		//with a broken structure
+		t := new(QuadTree[V])
+		t.dim = dim
+		t.gen = sr.gen
+		t.root = sr.root
+		t.size = sr.size
+		if err := t.Validate(); err != nil {
+			sr.fail(err.Error())
+		}
+	}
+	if sr.err == nil && sr.root != nil && !qt.fitsBounds(sr.root) {
+		sr.root = qt.rebuildInBounds(sr.root, maxNodeSize)
+	}
+	if sr.err == io.EOF {
+		sr.err = io.ErrUnexpectedEOF
+	}
+	return sr, sr.err
+}
+
+// install replaces the content of qt with the tree that was read.
+func (sr *serialReader[V]) install(qt *QuadTree[V]) {
+	qt.dim = sr.dim
+	qt.maxNodeSize = sr.maxNodeSize
+	qt.size = sr.size
+	qt.root = sr.root
+	qt.updateAggregates()
+}
+
+type countingWriter struct {
+	w io.Writer
+	n *int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	*cw.n += int64(n)
+	return n, err
+}
+
+// serialWriter remembers the first error, later writes are ignored.
+type serialWriter[V any] struct {
+	w     *bufio.Writer
+	crc   hash.Hash32
+	codec ValueCodec[V]
+	dim   int
+	n     int64
+	err   error
+	buf   [8]byte
+}
+
+func (sw *serialWriter[V]) writeBytes(b []byte) {
+	if sw.err == nil {
+		_, sw.err = sw.w.Write(b)
+	}
+}
+
+func (sw *serialWriter[V]) writeUint8(v uint8) {
+	sw.buf[0] = v
+	sw.writeBytes(sw.buf[:1])
+}
+
+func (sw *serialWriter[V]) writeUint16(v uint16) {
+	binary.LittleEndian.PutUint16(sw.buf[:], v)
+	sw.writeBytes(sw.buf[:2])
+}
+
+func (sw *serialWriter[V]) writeUint32(v uint32) {
+	binary.LittleEndian.PutUint32(sw.buf[:], v)
+	sw.writeBytes(sw.buf[:4])
+}
+
+func (sw *serialWriter[V]) writeUint64(v uint64) {
+	binary.LittleEndian.PutUint64(sw.buf[:], v)
+	sw.writeBytes(sw.buf[:8])
+}
+
+func (sw *serialWriter[V]) writeFloats(p []float64) {
+	for _, f := range p {
+		sw.writeUint64(math.Float64bits(f))
+	}
+}
+
+func (sw *serialWriter[V]) writeNode(n *Node[V]) {
+	sw.writeFloats(n.center)
+	sw.writeUint64(math.Float64bits(n.radius))
+	if n.isLeaf {
+		sw.writeUint8(1)
+		sw.writeUint32(uint32(n.nValues))
+		for i := 0; i < n.nValues; i++ {
+			sw.writeEntry(n.values[i])
+		}
+		return
+	}
+
+	sw.writeUint8(0)
+	sw.writeUint32(uint32(n.nSubs))
+	var buf [hcInlineWords]uint64
+	for i := 0; i < n.numSlots() && sw.err == nil; i++ {
+		sub := n.slot(i)
+		if sub.isEmpty() {
+			continue
+		}
+		var pos hcPos
+		if n.subs != nil {
+			pos = hcMake(sw.dim, buf[:])
+			pos[0] = uint64(i)
+		} else {
+			pos = n.slotPos(i)
+		}
+		for _, word := range pos {
+			sw.writeUint64(word)
+		}
+		if v := sub.node; v != nil {
+			sw.writeUint8(serialNode)
+			sw.writeNode(v)
+		} else if v := sub.entry; v != nil {
+			sw.writeUint8(serialEntry)
+			sw.writeEntry(v)
+		}
+	}
+}
+
+func (sw *serialWriter[V]) writeEntry(e *Entry[V]) {
+	sw.writeFloats(e.point)
+	if sw.err != nil {
+		return
+	}
+	data, err := sw.codec.MarshalValue(e.value)
+	if err != nil {
+		sw.err = err
+		return
+	}
+	sw.writeUint32(uint32(len(data)))
+	sw.writeBytes(data)
+}
+
+// serialReader remembers the first error, later reads return zero values.
+type serialReader[V any] struct {
+	r      io.Reader
+	crc    hash.Hash32
+	codec  ValueCodec[V]
+	dim    int
+	gen    uint64
+	unique bool
+	//checkBounds rejects points outside the domain of the tree
+	checkBounds func(key []float64) error
+	nEntries    uint64
+	n           int64
+	//the tree that was read
+	root        *Node[V]
+	maxNodeSize int
+	size        int
+	err         error
+	buf         []byte
+}
+
+func (sr *serialReader[V]) fail(msg string) {
+	if sr.err == nil {
+		sr.err = fmt.Errorf("%w: %s", ErrCorruptData, msg)
+	}
+}
+
+func (sr *serialReader[V]) readBytes(l int) []byte {
+	if sr.err != nil {
+		return nil
+	}
+	if cap(sr.buf) < l {
+		sr.buf = make([]byte, l)
+	}
+	b := sr.buf[:l]
+	n, err := io.ReadFull(sr.r, b)
+	sr.n += int64(n)
+	sr.err = err
+	return b
+}
+
+func (sr *serialReader[V]) readUint8() uint8 {
+	b := sr.readBytes(1)
+	if sr.err != nil {
+		return 0
+	}
+	return b[0]
+}
+
+func (sr *serialReader[V]) readUint16() uint16 {
+	b := sr.readBytes(2)
+	if sr.err != nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint16(b)
+}
+
+func (sr *serialReader[V]) readUint32() uint32 {
+	b := sr.readBytes(4)
+	if sr.err != nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint32(b)
+}
+
+func (sr *serialReader[V]) readUint64() uint64 {
+	b := sr.readBytes(8)
+	if sr.err != nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint64(b)
+}
+
+func (sr *serialReader[V]) readFloats(p []float64) {
+	b := sr.readBytes(8 * len(p))
+	if sr.err != nil {
+		return
+	}
+	for i := range p {
+		p[i] = math.Float64frombits(binary.LittleEndian.Uint64(b[8*i:]))
+	}
+}
+
+func (sr *serialReader[V]) readNode() *Node[V] {
+	center := make([]float64, sr.dim)
+	sr.readFloats(center)
+	radius := math.Float64frombits(sr.readUint64())
+	isLeaf := sr.readUint8() == 1
+	count := sr.readUint32()
+	if sr.err != nil {
+		return nil
+	}
+	if count > maxSerialLen {
+		sr.fail("bad node size")
+		return nil
+	}
+
+	n := newNode[V](center, radius)
+	n.gen = sr.gen
+	if isLeaf {
+		n.values = make([]*Entry[V], count)
+		//points of a leaf share one array
+		coords := make([]float64, int(count)*sr.dim)
+		for i := 0; i < int(count) && sr.err == nil; i++ {
+			n.values[i] = sr.readEntry(coords[i*sr.dim : (i+1)*sr.dim : (i+1)*sr.dim])
+			if n.values[i] != nil {
+				n.adopt(n.values[i])
+			}
+		}
+		if sr.unique && sr.err == nil {
+			//duplicates are always in the same leaf
+			for i := 1; i < int(count); i++ {
+				for j := 0; j < i; j++ {
+					if n.values[i].equals(n.values[j]) {
+						sr.fail("duplicate key")
+						return nil
+					}
+				}
+			}
+		}
+		n.nValues = int(count)
+		n.keys = coords
+		return n
+	}
+
+	n.values = nil
+	n.isLeaf = false
+	pos := make(hcPos, hcWords(sr.dim))
+	for i := 0; i < int(count) && sr.err == nil; i++ {
+		for w := range pos {
+			pos[w] = sr.readUint64()
+		}
+		if sr.dim&63 != 0 && pos[0]>>uint(sr.dim&63) != 0 {
+			sr.fail("bad hypercube position")
+			return nil
+		}
+		var sub child[V]
+		switch sr.readUint8() {
+		case serialNode:
+			sub.node = sr.readNode()
+		case serialEntry:
+			sub.entry = sr.readEntry(make([]float64, sr.dim))
+			n.nValues++
+		default:
+			sr.fail("bad slot type")
+		}
+		if sr.err != nil {
+			return nil
+		}
+		if !n.getSub(pos).isEmpty() {
+			sr.fail("duplicate slot")
+			return nil
+		}
+		n.setSub(pos, sub)
+		if sub.node != nil {
+			n.nEntries += sub.node.numEntries()
+		} else {
+			n.nEntries++
+		}
+	}
+	return n
+}
+
+func (sr *serialReader[V]) readEntry(point []float64) *Entry[V] {
+	sr.readFloats(point)
+	l := sr.readUint32()
+	if sr.err != nil {
+		return nil
+	}
+	for _, x := range point {
+		if math.IsNaN(x) || math.IsInf(x, 0) {
+			sr.fail("non-finite coordinate")
+			return nil
+		}
+	}
+	if err := sr.checkBounds(point); err != nil {
+		sr.err = err
+		return nil
+	}
+	if l > maxSerialLen {
+		sr.fail("bad value length")
+		return nil
+	}
+	data := sr.readBytes(int(l))
+	if sr.err != nil {
+		return nil
+	}
+	v, err := sr.codec.UnmarshalValue(data)
+	if err != nil {
+		sr.err = err
+		return nil
+	}
+	sr.nEntries++
+	return NewEntry(point, v)
+}
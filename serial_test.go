@@ -0,0 +1,130 @@
+package qthc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"math"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+// serialTree returns a tree with some removed entries, so its nodes are not
+// completely filled.
+func serialTree(dim int) *QuadTree[int] {
+	r := rand.New(rand.NewSource(int64(dim)))
+	qt := NewQuadTree[int](dim, 4)
+	var pts [][]float64
+	for i := 0; i < 500; i++ {
+		p := gridPoint(r, dim, 20)
+		pts = append(pts, p)
+		qt.Insert(p, i)
+	}
+	for _, p := range pts[:100] {
+		qt.Remove(p)
+	}
+	return qt
+}
+
+// withChecksum fixes the checksum of a modified stream.
+func withChecksum(data []byte) []byte {
+	n := len(data) - 4
+	binary.LittleEndian.PutUint32(data[n:], crc32.ChecksumIEEE(data[:n]))
+	return data
+}
+
+func TestSerialRoundTrip(t *testing.T) {
+	for _, dim := range []int{1, 2, 12, 70} {
+		qt := serialTree(dim)
+		data, err := qt.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		qt2 := NewQuadTree[int](3, 10)
+		if err := qt2.UnmarshalBinary(data); err != nil {
+			t.Fatalf("%d dimensions: %v", dim, err)
+		}
+		if err := qt2.Validate(); err != nil {
+			t.Fatalf("%d dimensions: %v", dim, err)
+		}
+		data2, err := qt2.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, data2) {
+			t.Fatalf("%d dimensions: the copy is written differently", dim)
+		}
+		for k, want := range qt.All() {
+			if vs, _ := qt2.GetAll(k); !slices.Contains(vs, want) {
+				t.Fatalf("%d dimensions: %v has %v in the copy, want %v", dim, k, vs, want)
+			}
+		}
+	}
+
+	//an empty tree
+	data, _ := NewQuadTree[int](2, 4).MarshalBinary()
+	qt := serialTree(2)
+	if err := qt.UnmarshalBinary(data); err != nil || qt.Size() != 0 || qt.root != nil {
+		t.Fatalf("reading an empty tree: %v, size %d", err, qt.Size())
+	}
+}
+
+func TestSerialCorruptInput(t *testing.T) {
+	data, _ := serialTree(2).MarshalBinary()
+	const header = 4 + 2 + 4 + 4 + 8 + 1
+	corrupt := func(f func(b []byte) []byte) []byte {
+		return f(append([]byte(nil), data...))
+	}
+	for _, c := range []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{"bad magic", corrupt(func(b []byte) []byte { b[0] = 'X'; return b }), ErrCorruptData},
+		{"version", corrupt(func(b []byte) []byte {
+			binary.LittleEndian.PutUint16(b[4:], serialVersion+1)
+			return withChecksum(b)
+		}), ErrCorruptData},
+		{"checksum", corrupt(func(b []byte) []byte { b[len(b)/2] ^= 1; return b }), ErrCorruptData},
+		{"trailing bytes", append(append([]byte(nil), data...), 0), ErrCorruptData},
+		{"size", corrupt(func(b []byte) []byte { b[14]++; return withChecksum(b) }), ErrCorruptData},
+		{"max node size", corrupt(func(b []byte) []byte {
+			binary.LittleEndian.PutUint32(b[10:], 0)
+			return withChecksum(b)
+		}), ErrCorruptData},
+		//the root is shrunk, its sub nodes no longer tile it
+		{"radius", corrupt(func(b []byte) []byte {
+			r := math.Float64frombits(binary.LittleEndian.Uint64(b[header+16:]))
+			binary.LittleEndian.PutUint64(b[header+16:], math.Float64bits(r/2))
+			return withChecksum(b)
+		}), ErrCorruptData},
+		{"center", corrupt(func(b []byte) []byte {
+			binary.LittleEndian.PutUint64(b[header:], math.Float64bits(1000))
+			return withChecksum(b)
+		}), ErrCorruptData},
+	} {
+		qt := serialTree(3)
+		before, _ := qt.MarshalBinary()
+		if err := qt.UnmarshalBinary(c.data); !errors.Is(err, c.err) {
+			t.Errorf("%s: error is %v, want %v", c.name, err, c.err)
+		}
+		//the tree is unchanged
+		if after, _ := qt.MarshalBinary(); !bytes.Equal(before, after) {
+			t.Errorf("%s: the tree changed", c.name)
+		}
+	}
+
+	for n := 0; n < len(data); n += 7 {
+		qt := NewQuadTree[int](2, 4)
+		err := qt.UnmarshalBinary(data[:n])
+		if !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, ErrCorruptData) {
+			t.Fatalf("truncated after %d bytes: error is %v", n, err)
+		}
+		if qt.Size() != 0 {
+			t.Fatalf("truncated after %d bytes: size is %d", n, qt.Size())
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package qthc
+
+import (
+	"fmt"
+	"unsafe"
+)
+
+// Stats describes the structure of a tree, see QuadTree.Stats().
+type Stats struct {
+	Dim, MaxNodeSize, Size int
+	LeafNodes, DirNodes    int
+	// EntriesPerDepth[d] is the number of entries stored in nodes at depth
+	// d, the root has depth 0.
+	EntriesPerDepth []int
+	// LeafFill[i] is the number of leaves with i entries for
+	// i <= MaxNodeSize, the last element counts all leaves with more
+	// entries.
+	LeafFill []int
+	// IdenticalOverflowLeaves is the number of leaves that hold more than
+	// MaxNodeSize entries because all their points are identical.
+	IdenticalOverflowLeaves int
+	// MaxDepth is the depth of the deepest node, AvgDepth is the average
+	// depth of the nodes that hold the entries.
+	MaxDepth int
+	AvgDepth float64
+	// Slots counts the slots of all directory nodes, EmptySlots the
+	// unused ones. Sparse directory nodes only have occupied slots.
+	Slots, EmptySlots int
+	// MemoryBytes is an estimate of the memory used by nodes and entries,
+	// not including memory referenced by values. Copied keys are counted
+	// with the coordinate arrays of the nodes, see CopyKeys.
+	MemoryBytes int64
+}
+
+func (s *Stats) Nodes() int {
+	return s.LeafNodes + s.DirNodes
+}
+
+func (s *Stats) EmptySlotRatio() float64 {
+	if s.Slots == 0 {
+		return 0
+	}
+	return float64(s.EmptySlots) / float64(s.Slots)
+}
+
+func (s *Stats) String() string {
+	return fmt.Sprintf("dim=%d maxNodeSize=%d size=%d nodes=%d leaves=%d dirs=%d "+
+		"maxDepth=%d avgDepth=%.2f identicalOverflow=%d emptySlots=%.2f memory=%d entriesPerDepth=%v leafFill=%v",
+		s.Dim, s.MaxNodeSize, s.Size, s.Nodes(), s.LeafNodes, s.DirNodes,
+		s.MaxDepth, s.AvgDepth, s.IdenticalOverflowLeaves, s.EmptySlotRatio(), s.MemoryBytes,
+		s.EntriesPerDepth, s.LeafFill)
+}
+
+// Stats traverses the tree and collects statistics about its structure.
+func (qt *QuadTree[V]) Stats() *Stats {
+	s := new(Stats)
+	s.Dim = qt.dim
+	s.MaxNodeSize = qt.maxNodeSize
+	s.Size = qt.size
+	s.LeafFill = make([]int, qt.maxNodeSize+2)
+	s.MemoryBytes = int64(unsafe.Sizeof(*qt))
+	if qt.root != nil {
+		qt.root.stats(s, 0)
+	}
+	if qt.keys == BorrowKeys {
+		s.MemoryBytes += int64(qt.size) * int64(qt.dim) * int64(unsafe.Sizeof(float64(0)))
+	}
+	n := 0
+	sum := 0
+	for d, c := range s.EntriesPerDepth {
+		n += c
+		sum += d * c
+	}
+	if n > 0 {
+		s.AvgDepth = float64(sum) / float64(n)
+	}
+	return s
+}
+
+func (n *Node[V]) stats(s *Stats, depth int) {
+	const (
+		sizeFloat = int64(unsafe.Sizeof(float64(0)))
+		sizePtr   = int64(unsafe.Sizeof(uintptr(0)))
+		sizePos   = int64(unsafe.Sizeof(uint64(0)))
+	)
+	sizeSlot := int64(unsafe.Sizeof(child[V]{}))
+	//the keys are counted with the coordinate arrays of the nodes
+	sizeEntry := int64(unsafe.Sizeof(Entry[V]{}))
+
+	if depth > s.MaxDepth {
+		s.MaxDepth = depth
+	}
+	for len(s.EntriesPerDepth) <= depth {
+		s.EntriesPerDepth = append(s.EntriesPerDepth, 0)
+	}
+	s.MemoryBytes += int64(unsafe.Sizeof(*n)) + int64(cap(n.center)+cap(n.keys))*sizeFloat
+
+	if n.isLeaf {
+		s.LeafNodes++
+		s.EntriesPerDepth[depth] += n.nValues
+		if n.nValues <= s.MaxNodeSize {
+			s.LeafFill[n.nValues]++
+		} else {
+			s.LeafFill[s.MaxNodeSize+1]++
+			if n.nValues > 0 && n.areAllPointsIdentical(n.values[0]) {
+				s.IdenticalOverflowLeaves++
+			}
+		}
+		s.MemoryBytes += int64(cap(n.values))*sizePtr + int64(n.nValues)*sizeEntry
+		return
+	}
+
+	s.DirNodes++
+	s.MemoryBytes += int64(cap(n.subs))*sizeSlot +
+		int64(cap(n.sparseSubs))*sizeSlot + int64(cap(n.sparsePos))*sizePos
+	for i := 0; i < n.numSlots(); i++ {
+		s.Slots++
+		c := n.slot(i)
+		if v := c.node; v != nil {
+			v.stats(s, depth+1)
+		} else if v := c.entry; v != nil {
+			s.EntriesPerDepth[depth]++
+			s.MemoryBytes += sizeEntry
+		} else {
+			s.EmptySlots++
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package qthc
+
+import (
+	"math/rand"
+	"slices"
+	"testing"
+	"unsafe"
+)
+
+// keyArrays returns the coordinate arrays of the nodes of the sub tree of n.
+func keyArrays[V any](n *Node[V], arrays [][]float64) [][]float64 {
+	arrays = append(arrays, n.keys[:cap(n.keys)])
+	for i := 0; !n.isLeaf && i < n.numSlots(); i++ {
+		if sub := n.slot(i).node; sub != nil {
+			arrays = keyArrays(sub, arrays)
+		}
+	}
+	return arrays
+}
+
+func TestUpdatedKeysAreStoredInNodes(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	qt := New[int](2, WithMaxNodeSize(4))
+	keys := make([][]float64, 200)
+	for i := range keys {
+		keys[i] = []float64{r.Float64(), r.Float64()}
+		qt.Insert(keys[i], i)
+	}
+	for i := range keys {
+		//small moves stay in their node, large ones leave it or grow the root
+		key := []float64{keys[i][0] + r.NormFloat64()*0.01, keys[i][1] + r.NormFloat64()}
+		if _, ok, err := qt.Update(keys[i], key); !ok || err != nil {
+			t.Fatalf("update %d failed: %v", i, err)
+		}
+		keys[i] = key
+		//entries keep their key when their node is merged later, so check
+		//the node that received the entry right away
+		p := qt.root.getExact(key).point
+		found := false
+		for _, a := range keyArrays(qt.root, nil) {
+			for j := range a {
+				found = found || &a[j] == &p[0]
+			}
+		}
+		if !found {
+			t.Fatalf("key %v is not stored in a node", key)
+		}
+	}
+
+	keyBytes := int64(0)
+	for _, a := range keyArrays(qt.root, nil) {
+		keyBytes += int64(cap(a)) * int64(unsafe.Sizeof(float64(0)))
+	}
+	if s := qt.Stats(); s.MemoryBytes < keyBytes {
+		t.Fatalf("MemoryBytes is %d, the keys use %d bytes", s.MemoryBytes, keyBytes)
+	}
+	if err := qt.Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStatsOfSmallTree(t *testing.T) {
+	qt := New[int](2, WithMaxNodeSize(2), WithBounds([]float64{0, 0}, []float64{8, 8}, Reject))
+	for i, p := range [][]float64{{1, 1}, {1, 1}, {5, 1}, {5, 5}, {6, 6}, {7, 7}, {1, 1}} {
+		qt.Insert(p, i)
+	}
+	//the root holds (5,1), a leaf with the identical points and a
+	//directory node with (5,5) and a leaf with (6,6) and (7,7)
+	s := qt.Stats()
+	if s.LeafNodes != 2 || s.DirNodes != 2 || s.MaxDepth != 2 {
+		t.Errorf("got %d leaves, %d directory nodes and depth %d", s.LeafNodes, s.DirNodes, s.MaxDepth)
+	}
+	if want := []int{0, 0, 1, 1}; !slices.Equal(s.LeafFill, want) {
+		t.Errorf("LeafFill is %v, want %v", s.LeafFill, want)
+	}
+	if want := []int{1, 4, 2}; !slices.Equal(s.EntriesPerDepth, want) {
+		t.Errorf("EntriesPerDepth is %v, want %v", s.EntriesPerDepth, want)
+	}
+	if s.IdenticalOverflowLeaves != 1 {
+		t.Errorf("IdenticalOverflowLeaves is %d, want 1", s.IdenticalOverflowLeaves)
+	}
+	if s.Slots != 8 || s.EmptySlots != 3 || s.EmptySlotRatio() != 0.375 {
+		t.Errorf("got %d of %d slots empty", s.EmptySlots, s.Slots)
+	}
+
+	//a leaf below the maximum depth overflows with different points, the
+	//sparse root only has the occupied slot
+	qt = New[int](2, WithMaxNodeSize(2), WithMaxDepth(0), WithBounds([]float64{0, 0}, []float64{8, 8}, Reject))
+	for i, p := range [][]float64{{1, 1}, {1, 2}, {2, 1}, {2, 2}, {3, 3}} {
+		qt.Insert(p, i)
+	}
+	s = qt.Stats()
+	if want := []int{0, 0, 0, 1}; !slices.Equal(s.LeafFill, want) {
+		t.Errorf("LeafFill is %v, want %v", s.LeafFill, want)
+	}
+	if s.IdenticalOverflowLeaves != 0 {
+		t.Errorf("IdenticalOverflowLeaves is %d, want 0", s.IdenticalOverflowLeaves)
+	}
+	if s.Slots != 1 || s.EmptySlots != 0 || s.EmptySlotRatio() != 0 {
+		t.Errorf("got %d of %d slots empty", s.EmptySlots, s.Slots)
+	}
+}
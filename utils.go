@@ -4,10 +4,13 @@ import (
 	"math"
 )
 
-type QueryIterator interface {
+type QueryIterator[V any] interface {
 	HasNext() bool
-	Next() *Entry
+	Next() *Entry[V]
 	Reset(min, max []float64)
+	// Err returns the error that prevented the last query from running,
+	// for example ErrInvalidRange.
+	Err() error
 }
 
 const (
@@ -41,6 +44,20 @@ func isPointEqual(p1, p2 []float64) bool {
 	return true
 }
 
+// comparePoints orders points lexicographically. It is used to break ties
+// between entries with equal distance.
+func comparePoints(p1, p2 []float64) int {
+	for d := 0; d < len(p1); d++ {
+		if p1[d] < p2[d] {
+			return -1
+		}
+		if p1[d] > p2[d] {
+			return 1
+		}
+	}
+	return 0
+}
+
 func overlap(min, max, min2, max2 []float64) bool {
 	for d := 0; d < len(min); d++ {
 		if max[d] < min2[d] || min[d] > max2[d] {
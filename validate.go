@@ -0,0 +1,229 @@
+package qthc
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+var ErrInvalidTree = errors.New("qthc: invalid tree")
+
+// Validate checks the structural invariants of the tree:
+//   - every entry lies inside its node and is found by descending from the
+//     root, which implies that the root covers all points,
+//   - sub nodes exactly tile their quadrant of the parent node,
+//   - nValues and nSubs match the occupied slots, nEntries matches the
+//     entries of the sub tree,
+//   - in trees that don't share nodes, entries and nodes know their node
+//     and parent,
+//   - nodes with changed aggregates have changed parents, see
+//     AddAggregator(),
+//   - size matches the number of reachable entries.
+//
+// The returned error describes the first violation and the path of
+// hypercube positions to the node where it was found. Validate is meant for
+// tests and debugging, it is slow.
+func (qt *QuadTree[V]) Validate() error {
+	v := new(validator[V])
+	v.dim = qt.dim
+	if qt.root != nil {
+		if len(qt.root.center) != qt.dim {
+			return v.errorf("root has %d dimensions instead of %d", len(qt.root.center), qt.dim)
+		}
+		if qt.root.gen == 0 && qt.root.parent != nil {
+			return v.errorf("root has a parent")
+		}
+		if err := v.check(qt.root); err != nil {
+			return err
+		}
+	}
+	if v.nEntries != qt.size {
+		return fmt.Errorf("%w: size is %d but %d entries are reachable", ErrInvalidTree, qt.size, v.nEntries)
+	}
+	return nil
+}
+
+type validator[V any] struct {
+	dim      int
+	nEntries int
+	//ancestors of the current node and the positions taken in them
+	nodes []*Node[V]
+	path  []hcPos
+}
+
+func (v *validator[V]) errorf(format string, args ...interface{}) error {
+	var b strings.Builder
+	b.WriteString("root")
+	for _, p := range v.path {
+		b.WriteByte('/')
+		for d := 0; d < v.dim; d++ {
+			if p.isSet(v.dim, d) {
+				b.WriteByte('1')
+			} else {
+				b.WriteByte('0')
+			}
+		}
+	}
+	return fmt.Errorf("%w: at %s: %s", ErrInvalidTree, b.String(), fmt.Sprintf(format, args...))
+}
+
+func (v *validator[V]) check(n *Node[V]) error {
+	if !(n.radius > 0) || math.IsInf(n.radius, 0) {
+		return v.errorf("bad radius %v", n.radius)
+	}
+	if n.isLeaf {
+		if n.subs != nil || n.sparseSubs != nil || n.nSubs != 0 {
+			return v.errorf("leaf node has sub nodes")
+		}
+		if n.nValues < 0 || n.nValues > len(n.values) {
+			return v.errorf("nValues is %d but there are %d value slots", n.nValues, len(n.values))
+		}
+		for i := 0; i < n.nValues; i++ {
+			e := n.values[i]
+			if e == nil {
+				return v.errorf("value %d is nil", i)
+			}
+			if err := v.checkEntry(n, e); err != nil {
+				return err
+			}
+		}
+		for i := n.nValues; i < len(n.values); i++ {
+			if n.values[i] != nil {
+				return v.errorf("unused value slot %d is not cleared", i)
+			}
+		}
+		return nil
+	}
+
+	if n.nValues != 0 && n.values != nil {
+		return v.errorf("directory node has leaf values")
+	}
+	if n.subs != nil && n.sparseSubs != nil {
+		return v.errorf("directory node has dense and sparse slots")
+	}
+	w := hcWords(v.dim)
+	if n.subs != nil {
+		if v.dim > maxDenseDim || len(n.subs) != 1<<uint(v.dim) {
+			return v.errorf("dense node has %d slots", len(n.subs))
+		}
+	} else if len(n.sparsePos) != len(n.sparseSubs)*w {
+		return v.errorf("sparse node has %d positions for %d slots", len(n.sparsePos), len(n.sparseSubs))
+	}
+
+	nSubs, nValues := 0, 0
+	nEntries := v.nEntries
+	pos := make(hcPos, w)
+	for i := 0; i < n.numSlots(); i++ {
+		sub := n.slot(i)
+		if n.subs != nil {
+			pos[0] = uint64(i)
+		} else {
+			copy(pos, n.slotPos(i))
+			if i > 0 && n.slotPos(i-1).compare(pos) >= 0 {
+				return v.errorf("sparse positions are not sorted")
+			}
+			if v.dim&63 != 0 && pos[0]>>uint(v.dim&63) != 0 {
+				return v.errorf("bad sparse position %v", pos)
+			}
+			if sub.isEmpty() {
+				return v.errorf("sparse slot %d is empty", i)
+			}
+		}
+		if sub.isEmpty() {
+			continue
+		}
+		if sub.node != nil && sub.entry != nil {
+			return v.errorf("slot %d holds a node and an entry", i)
+		}
+		nSubs++
+
+		v.nodes = append(v.nodes, n)
+		v.path = append(v.path, append(hcPos(nil), pos...))
+		var err error
+		if s := sub.node; s != nil {
+			err = v.checkTile(n, s, pos)
+			if err == nil && n.gen == 0 && s.gen == 0 && s.parent != n {
+				err = v.errorf("node doesn't point to its parent")
+			}
+			if err == nil && s.dirty && !n.dirty {
+				err = v.errorf("changed node has an unchanged parent")
+			}
+			if err == nil {
+				err = v.check(s)
+			}
+		} else {
+			nValues++
+			err = v.checkEntry(n, sub.entry)
+		}
+		v.nodes = v.nodes[:len(v.nodes)-1]
+		v.path = v.path[:len(v.path)-1]
+		if err != nil {
+			return err
+		}
+	}
+	if nSubs != n.nSubs {
+		return v.errorf("nSubs is %d but %d slots are occupied", n.nSubs, nSubs)
+	}
+	if nValues != n.nValues {
+		return v.errorf("nValues is %d but %d slots hold entries", n.nValues, nValues)
+	}
+	if v.nEntries-nEntries != n.nEntries {
+		return v.errorf("nEntries is %d but the sub tree has %d entries", n.nEntries, v.nEntries-nEntries)
+	}
+	return nil
+}
+
+// checkTile checks that sub has the box that createSubForEntry() gives it.
+// Sub nodes created by growing the root may differ by rounding errors.
+func (v *validator[V]) checkTile(n, sub *Node[V], pos hcPos) error {
+	if len(sub.center) != v.dim {
+		return v.errorf("node has %d dimensions instead of %d", len(sub.center), v.dim)
+	}
+	radiusSub := n.radius / 2.0
+	if sub.radius != radiusSub {
+		return v.errorf("radius is %v but should be %v", sub.radius, radiusSub)
+	}
+	for d := 0; d < v.dim; d++ {
+		c := n.center[d] - radiusSub
+		if pos.isSet(v.dim, d) {
+			c = n.center[d] + radiusSub
+		}
+		if math.Abs(sub.center[d]-c) > tolerance(c, radiusSub) {
+			return v.errorf("center is %v but should be %v in dimension %d", sub.center[d], c, d)
+		}
+	}
+	return nil
+}
+
+// tolerance returns the rounding error that is accepted for a box
+// coordinate.
+func tolerance(center, radius float64) float64 {
+	return (EPS_MUL - 1) * (math.Abs(center) + radius)
+}
+
+// checkEntry checks that e, stored in n, lies inside n and is found by
+// descending from the root.
+func (v *validator[V]) checkEntry(n *Node[V], e *Entry[V]) error {
+	v.nEntries++
+	if len(e.point) != v.dim {
+		return v.errorf("entry %v has %d dimensions instead of %d", e.point, len(e.point), v.dim)
+	}
+	if n.gen == 0 && e.node != n {
+		return v.errorf("entry %v doesn't point to its node", e.point)
+	}
+	//boxes of deep nodes suffer from rounding errors, the exact check is
+	//whether the entry can be reached
+	for d := 0; d < v.dim; d++ {
+		if math.Abs(e.point[d]-n.center[d]) > n.radius+tolerance(n.center[d], n.radius) {
+			return v.errorf("entry %v is outside center %v radius %v", e.point, n.center, n.radius)
+		}
+	}
+	var buf [hcInlineWords]uint64
+	for i, a := range v.nodes {
+		if a.calcSubPosition(e.point, buf[:]).compare(v.path[i]) != 0 {
+			return v.errorf("entry %v is not reachable from the root", e.point)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package qthc
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidateFindsCorruption(t *testing.T) {
+	tests := []struct {
+		name    string
+		corrupt func(qt *QuadTree[int])
+		want    string
+	}{
+		{"nValues of directory", func(qt *QuadTree[int]) {
+			qt.root.subs[3].node.nValues++
+		}, "at root/11: nValues is 2 but 1 slots hold entries"},
+		{"nValues of leaf", func(qt *QuadTree[int]) {
+			qt.root.subs[0].node.nValues = 5
+		}, "at root/00: nValues is 5 but there are"},
+		{"nEntries", func(qt *QuadTree[int]) {
+			qt.root.subs[3].node.nEntries--
+		}, "at root/11: nEntries is 2 but the sub tree has 3 entries"},
+		{"entry outside of node", func(qt *QuadTree[int]) {
+			qt.root.subs[3].node.subs[3].node.values[0].point = []float64{3, 3}
+		}, "at root/11/11: entry [3 3] is outside"},
+		{"unreachable entry", func(qt *QuadTree[int]) {
+			qt.root.getExact([]float64{5, 1}).point = []float64{3, 1}
+		}, "at root/10: entry [3 1] is not reachable"},
+		{"tile center", func(qt *QuadTree[int]) {
+			qt.root.subs[3].node.center[0]++
+		}, "at root/11: center is 7 but should be 6 in dimension 0"},
+		{"tile radius", func(qt *QuadTree[int]) {
+			qt.root.subs[3].node.subs[3].node.radius = 2
+		}, "at root/11/11: radius is 2 but should be 1"},
+		{"parent", func(qt *QuadTree[int]) {
+			qt.root.subs[0].node.parent = nil
+		}, "at root/00: node doesn't point to its parent"},
+		{"size", func(qt *QuadTree[int]) {
+			qt.size++
+		}, "size is 8 but 7 entries are reachable"},
+	}
+	for _, test := range tests {
+		//see TestStatsOfSmallTree for the shape of the tree
+		qt := New[int](2, WithMaxNodeSize(2), WithBounds([]float64{0, 0}, []float64{8, 8}, Reject))
+		for i, p := range [][]float64{{1, 1}, {1, 1}, {5, 1}, {5, 5}, {6, 6}, {7, 7}, {1, 1}} {
+			qt.Insert(p, i)
+		}
+		if err := qt.Validate(); err != nil {
+			t.Fatal(err)
+		}
+		test.corrupt(qt)
+		err := qt.Validate()
+		if !errors.Is(err, ErrInvalidTree) || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: got %v, want %q", test.name, err, test.want)
+		}
+	}
+}
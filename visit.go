@@ -0,0 +1,113 @@
+package qthc
+
+// NodeView is a read-only view of a node for VisitNodes().
+type NodeView[V any] struct {
+	n     *Node[V]
+	depth int
+}
+
+// Center returns a copy of the center of the node.
+func (v NodeView[V]) Center() []float64 {
+	return append([]float64(nil), v.n.center...)
+}
+
+// AppendCenter appends the center of the node to dst, see Entry.AppendPoint().
+func (v NodeView[V]) AppendCenter(dst []float64) []float64 {
+	return append(dst, v.n.center...)
+}
+
+// Radius returns half the side length of the node's hypercube.
+func (v NodeView[V]) Radius() float64 {
+	return v.n.radius
+}
+
+// Depth returns the distance to the root, which has depth 0.
+func (v NodeView[V]) Depth() int {
+	return v.depth
+}
+
+func (v NodeView[V]) IsLeaf() bool {
+	return v.n.isLeaf
+}
+
+// NumEntries returns the number of entries in the sub tree of the node.
+func (v NodeView[V]) NumEntries() int {
+	return v.n.numEntries()
+}
+
+// VisitIntersect calls fn for each entry inside the window min/max, the same
+// entries that SearchIntersect() returns, until fn returns false. Unlike an
+// iterator it keeps no state outside of the call stack. It does nothing if
+// the window is invalid. fn must not modify the tree.
+func (qt *QuadTree[V]) VisitIntersect(min, max []float64, fn func(e *Entry[V]) bool) {
+	if qt.root == nil || qt.checkWindow(min, max) != nil {
+		return
+	}
+	qt.root.visitIntersect(min, max, fn)
+}
+
+// visitIntersect returns false if fn stopped the visit.
+func (n *Node[V]) visitIntersect(min, max []float64, fn func(e *Entry[V]) bool) bool {
+	if n.isLeaf {
+		for _, e := range n.values[:n.nValues] {
+			if e.enclosed(min, max) && !fn(e) {
+				return false
+			}
+		}
+		return true
+	}
+
+	visit := func(sub child[V]) bool {
+		if v := sub.node; v != nil {
+			return v.visitIntersect(min, max, fn)
+		} else if v := sub.entry; v != nil {
+			return !v.enclosed(min, max) || fn(v)
+		}
+		return true
+	}
+	var buf0, buf1 [hcInlineWords]uint64
+	m0, m1 := n.masks(min, max, buf0[:], buf1[:])
+	if n.subs != nil {
+		var buf [hcInlineWords]uint64
+		pos := hcMake(len(n.center), buf[:])
+		copy(pos, m0)
+		for {
+			if !visit(n.subs[pos[0]]) {
+				return false
+			}
+			if !pos.inc(m0, m1) {
+				return true
+			}
+		}
+	}
+	i, _ := n.findSparse(m0)
+	for ; i < len(n.sparseSubs); i++ {
+		p := n.slotPos(i)
+		if p.compare(m1) > 0 {
+			break
+		}
+		if p.isValid(m0, m1) && !visit(n.sparseSubs[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// VisitNodes calls fn for the root and, depth first, for the sub nodes of
+// every node for which fn returns true. fn must not modify the tree.
+func (qt *QuadTree[V]) VisitNodes(fn func(v NodeView[V]) (descend bool)) {
+	if qt.root != nil {
+		qt.root.visitNodes(0, fn)
+	}
+}
+
+func (n *Node[V]) visitNodes(depth int, fn func(v NodeView[V]) bool) {
+	if !fn(NodeView[V]{n, depth}) || n.isLeaf {
+		return
+	}
+	for i := 0; i < n.numSlots(); i++ {
+		if v := n.slot(i).node; v != nil {
+			v.visitNodes(depth+1, fn)
+		}
+	}
+}
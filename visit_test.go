@@ -0,0 +1,112 @@
+package qthc
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestVisitIntersectStops(t *testing.T) {
+	for _, dim := range []int{1, 2, 3, 12} {
+		r := rand.New(rand.NewSource(int64(dim)))
+		qt := New[int](dim, WithMaxNodeSize(4))
+		for i := 0; i < 2000; i++ {
+			qt.Insert(randomPoint(r, dim), i)
+		}
+		min, max := make([]float64, dim), make([]float64, dim)
+		for d := range min {
+			min[d], max[d] = 0.1, 0.9
+		}
+		var all []*Entry[int]
+		for it := qt.SearchIntersect(min, max); it.HasNext(); {
+			all = append(all, it.Next())
+		}
+		if len(all) < 10 {
+			t.Fatalf("%d dimensions: the window holds %d entries", dim, len(all))
+		}
+		//stops inside leaves, after sub nodes and after the last entry
+		for _, stop := range []int{1, 2, 5, len(all) / 2, len(all) - 1, len(all)} {
+			var got []*Entry[int]
+			qt.VisitIntersect(min, max, func(e *Entry[int]) bool {
+				got = append(got, e)
+				return len(got) < stop
+			})
+			if len(got) != stop {
+				t.Fatalf("%d dimensions: fn is called %d times after it returned false at %d", dim, len(got), stop)
+			}
+			for i, e := range got {
+				if e != all[i] {
+					t.Fatalf("%d dimensions: entry %d differs from SearchIntersect()", dim, i)
+				}
+			}
+		}
+	}
+}
+
+func TestVisitNodes(t *testing.T) {
+	for _, dim := range []int{1, 2, 3, 12} {
+		r := rand.New(rand.NewSource(int64(dim)))
+		qt := New[int](dim, WithMaxNodeSize(4))
+		for i := 0; i < 2000; i++ {
+			qt.Insert(randomPoint(r, dim), i)
+		}
+		stats := qt.Stats()
+
+		//the depth halves the radius, the first visit is the root
+		nodes, maxDepth := 0, 0
+		rootRadius := qt.root.radius
+		qt.VisitNodes(func(v NodeView[int]) bool {
+			if nodes == 0 && v.Depth() != 0 {
+				t.Fatalf("%d dimensions: root has depth %d", dim, v.Depth())
+			}
+			if v.Radius() != math.Ldexp(rootRadius, -v.Depth()) {
+				t.Fatalf("%d dimensions: node with radius %v has depth %d", dim, v.Radius(), v.Depth())
+			}
+			nodes++
+			maxDepth = max(maxDepth, v.Depth())
+			return true
+		})
+		if nodes != stats.Nodes() || maxDepth != stats.MaxDepth {
+			t.Errorf("%d dimensions: %d nodes up to depth %d are visited, want %d up to %d",
+				dim, nodes, maxDepth, stats.Nodes(), stats.MaxDepth)
+		}
+
+		//nodes with few entries are not descended into
+		var path []NodeView[int]
+		var descended []bool
+		pruned := 0
+		qt.VisitNodes(func(v NodeView[int]) bool {
+			if v.Depth() > len(path) {
+				t.Fatalf("%d dimensions: depth %d follows depth %d", dim, v.Depth(), len(path)-1)
+			}
+			path, descended = path[:v.Depth()], descended[:v.Depth()]
+			if v.Depth() > 0 {
+				if !descended[v.Depth()-1] {
+					t.Fatalf("%d dimensions: sub node of a pruned node is visited", dim)
+				}
+				if parent := path[v.Depth()-1]; v.NumEntries() > parent.NumEntries() {
+					t.Fatalf("%d dimensions: node at depth %d isn't in the sub tree of its parent", dim, v.Depth())
+				}
+			}
+			descend := v.NumEntries() >= 50
+			if !descend && !v.IsLeaf() {
+				pruned++
+			}
+			path, descended = append(path, v), append(descended, descend)
+			return descend
+		})
+		if pruned == 0 {
+			t.Errorf("%d dimensions: no directory node is pruned", dim)
+		}
+
+		//only the root
+		nodes = 0
+		qt.VisitNodes(func(v NodeView[int]) bool {
+			nodes++
+			return false
+		})
+		if nodes != 1 {
+			t.Errorf("%d dimensions: %d nodes are visited without descending", dim, nodes)
+		}
+	}
+}